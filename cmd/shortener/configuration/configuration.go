@@ -3,6 +3,8 @@ package configuration
 
 import (
 	"flag"
+	"time"
+
 	"github.com/caarlos0/env/v6"
 )
 
@@ -10,8 +12,11 @@ var paramNames = map[string]string{
 	"BASE_URL":          "b",
 	"SERVER_ADDRESS":    "a",
 	"FILE_STORAGE_PATH": "f",
+	"DATABASE_DSN":      "d",
 	"ENABLE_HTTPS":      "s",
-	"CONFIG":  "c",
+	"CONFIG":            "c",
+	"GRPC_ADDRESS":      "g",
+	"TRUSTED_SUBNET":    "t",
 }
 
 type Config struct {
@@ -19,11 +24,85 @@ type Config struct {
 	BaseURL         string `env:"BASE_URL"`
 	FileStoragePath string `env:"FILE_STORAGE_PATH" envDefault:""`
 	Database        string `env:"DATABASE_DSN"`
-	EnableHTTPS    	bool   `env:"ENABLE_HTTPS"`
-	Config 			string `env:"CONFIG"`
+	EnableHTTPS     bool   `env:"ENABLE_HTTPS"`
+	Config          string `env:"CONFIG"`
+	// FileSync политика fsync журнала фаилового хранилища: always, interval или never.
+	FileSync         string        `env:"FILE_SYNC" envDefault:"interval"`
+	FileSyncInterval time.Duration `env:"FILE_SYNC_INTERVAL" envDefault:"1s"`
+	// FileCompactEvery число записей журнала, после которого он сворачивается в снимок.
+	FileCompactEvery int `env:"FILE_COMPACT_EVERY" envDefault:"10000"`
+	// GRPCAddress адрес gRPC сервера, по умолчанию пустой и сервер выключен.
+	// При EnableHTTPS сервер использует те же сертификаты.
+	GRPCAddress string `env:"GRPC_ADDRESS"`
+	// TLSCertFile и TLSKeyFile сертификат и ключ HTTPS сервера, перечитываются по SIGHUP.
+	TLSCertFile string `env:"TLS_CERT_FILE" envDefault:"server.crt"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE" envDefault:"server.key"`
+	// TLSSelfSigned создает самоподписанный сертификат, если фаилов нет. Только для разработки.
+	TLSSelfSigned bool `env:"TLS_SELF_SIGNED"`
+	// ACMEDomains домены через запятую для автоматического выпуска сертификатов по ACME.
+	ACMEDomains      string `env:"ACME_DOMAINS"`
+	ACMECacheDir     string `env:"ACME_CACHE_DIR" envDefault:"certs"`
+	ACMEDirectoryURL string `env:"ACME_DIRECTORY_URL"`
+	ACMEEmail        string `env:"ACME_EMAIL"`
+	// TrustedSubnet подсеть в нотации CIDR, из которой доступна внутренняя статистика.
+	// Пустая подсеть закрывает доступ всем.
+	TrustedSubnet string `env:"TRUSTED_SUBNET"`
+	// TrustedProxies подсети прокси через запятую, которым доверяется адрес клиента из X-Real-IP.
+	// Без них адресом клиента считается адрес соединения.
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+	// LogLevel уровень логов: debug, info, warn или error. LogFormat формат: json или console.
+	LogLevel  string `env:"LOG_LEVEL" envDefault:"info"`
+	LogFormat string `env:"LOG_FORMAT" envDefault:"json"`
+	// CacheSize число коротких кодов в кеше редиректов, 0 отключает кеш.
+	// CacheTTL время жизни найденной ссылки в кеше, CacheNegativeTTL отсутствующего кода.
+	CacheSize        int           `env:"CACHE_SIZE" envDefault:"10000"`
+	CacheTTL         time.Duration `env:"CACHE_TTL" envDefault:"1m"`
+	CacheNegativeTTL time.Duration `env:"CACHE_NEGATIVE_TTL" envDefault:"10s"`
+	// RateCreate и RateRedirect ограничения создания ссылок и редиректов для каждого пользователя
+	// и каждого адреса: запросов в секунду и запас. Нулевая частота снимает ограничение.
+	RateCreateRPS     float64 `env:"RATE_CREATE_RPS" envDefault:"5"`
+	RateCreateBurst   int     `env:"RATE_CREATE_BURST" envDefault:"20"`
+	RateRedirectRPS   float64 `env:"RATE_REDIRECT_RPS" envDefault:"50"`
+	RateRedirectBurst int     `env:"RATE_REDIRECT_BURST" envDefault:"100"`
+	// RateLimitShared хранит корзины в Postgres, чтобы ограничение было общим для всех экземпляров.
+	RateLimitShared bool `env:"RATE_LIMIT_SHARED"`
+	// URLSchemes допустимые схемы сокращаемых URL через запятую, URLMaxLength их максимальная длина.
+	URLSchemes   string `env:"URL_SCHEMES" envDefault:"http,https"`
+	URLMaxLength int    `env:"URL_MAX_LENGTH" envDefault:"2048"`
+	// URLBlocklist фаил с запрещенными доменами и подсетями по одному на строку.
+	URLBlocklist string `env:"URL_BLOCKLIST_FILE"`
+	// URLResolve запрещает домены, которые разрешаются в частные адреса. Требует DNS при каждом сокращении.
+	URLResolve bool `env:"URL_RESOLVE"`
+	// URLSortQuery сортирует параметры запроса при приведении URL к каноническому виду.
+	URLSortQuery bool `env:"URL_SORT_QUERY" envDefault:"true"`
+	// URLStripTracking удаляет utm_*, fbclid и другие параметры отслеживания,
+	// URLStripParams дополнительные удаляемые параметры через запятую, * на конце задает префикс.
+	URLStripTracking bool   `env:"URL_STRIP_TRACKING"`
+	URLStripParams   string `env:"URL_STRIP_PARAMS"`
+	// ShortCodeGenerator генератор коротких кодов: hash или sequence.
+	ShortCodeGenerator string `env:"SHORT_CODE_GENERATOR" envDefault:"hash"`
+	ShortCodeLength    int    `env:"SHORT_CODE_LENGTH" envDefault:"8"`
+	// ShortCodeAttempts число попыток подобрать код при коллизиях.
+	ShortCodeAttempts int `env:"SHORT_CODE_ATTEMPTS" envDefault:"10"`
+	// SweepInterval период пометки удаленными ссылок с истекшим сроком действия.
+	SweepInterval time.Duration `env:"SWEEP_INTERVAL" envDefault:"1m"`
+	// AnalyticsBatchSize и AnalyticsFlushInterval управляют пакетным сохранением переходов.
+	AnalyticsBatchSize     int           `env:"ANALYTICS_BATCH_SIZE" envDefault:"100"`
+	AnalyticsFlushInterval time.Duration `env:"ANALYTICS_FLUSH_INTERVAL" envDefault:"5s"`
+	// AnalyticsSalt соль хеша адресов посетителей.
+	AnalyticsSalt string `env:"ANALYTICS_SALT"`
+	// DeleteResumeInterval период повторной постановки в пул незавершенных задач удаления.
+	DeleteResumeInterval time.Duration `env:"DELETE_RESUME_INTERVAL" envDefault:"10s"`
+	// ShutdownTimeout срок каждого этапа остановки, DrainTimeout срок выполнения очереди задач.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"5s"`
+	DrainTimeout    time.Duration `env:"DRAIN_TIMEOUT" envDefault:"10s"`
+	// CookieKeys ключи подписи кук вида "kid:hexkey,kid:hexkey", первый активный.
+	CookieKeys string `env:"COOKIE_KEYS"`
+	// CookieKeysFile фаил с ключами подписи кук по одному на строку, читается после CookieKeys.
+	CookieKeysFile string        `env:"COOKIE_KEYS_FILE"`
+	CookieTTL      time.Duration `env:"COOKIE_TTL" envDefault:"720h"`
 }
 
-
 func New() Config {
 	// Parse environment
 	var cEnv Config
@@ -31,49 +110,127 @@ func New() Config {
 	if err != nil {
 		panic(err)
 	}
+	// flags
+	fcfg := flag.String(paramNames["CONFIG"], "", "")
+	bu := flag.String(paramNames["BASE_URL"], "", "")
+	sa := flag.String(paramNames["SERVER_ADDRESS"], "", "")
+	fs := flag.String(paramNames["FILE_STORAGE_PATH"], "", "")
+	db := flag.String(paramNames["DATABASE_DSN"], "", "")
+	ga := flag.String(paramNames["GRPC_ADDRESS"], "", "")
+	ts := flag.String(paramNames["TRUSTED_SUBNET"], "", "")
+	tls := flag.Bool(paramNames["ENABLE_HTTPS"], false, "")
+	flag.Parse()
+	// флаг переопределяет переменную окружения и фаил, только если задан явно
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
 	// file config
 	var c Config
-	fcfg := flag.String(paramNames["CONFIG"], "", "")
-	if *fcfg != "" {
+	if set[paramNames["CONFIG"]] {
 		cEnv.Config = *fcfg
 	}
 	if cEnv.Config != "" {
 		c, _ = getConfigFromFIle(cEnv.Config)
 	}
 
-	c.EnableHTTPS = cEnv.EnableHTTPS
+	c.EnableHTTPS = c.EnableHTTPS || cEnv.EnableHTTPS
+	c.FileSyncInterval = cEnv.FileSyncInterval
+	c.FileCompactEvery = cEnv.FileCompactEvery
+	c.LogLevel = cEnv.LogLevel
+	c.LogFormat = cEnv.LogFormat
+	c.CacheSize = cEnv.CacheSize
+	c.RateCreateRPS = cEnv.RateCreateRPS
+	c.RateCreateBurst = cEnv.RateCreateBurst
+	c.RateRedirectRPS = cEnv.RateRedirectRPS
+	c.RateRedirectBurst = cEnv.RateRedirectBurst
+	c.RateLimitShared = cEnv.RateLimitShared
+	c.CacheTTL = cEnv.CacheTTL
+	c.CacheNegativeTTL = cEnv.CacheNegativeTTL
+	c.URLMaxLength = cEnv.URLMaxLength
+	c.URLResolve = c.URLResolve || cEnv.URLResolve
+	c.URLSortQuery = cEnv.URLSortQuery
+	c.URLStripTracking = cEnv.URLStripTracking
+	c.URLStripParams = cEnv.URLStripParams
+	c.ShortCodeGenerator = cEnv.ShortCodeGenerator
+	c.ShortCodeLength = cEnv.ShortCodeLength
+	c.ShortCodeAttempts = cEnv.ShortCodeAttempts
+	c.SweepInterval = cEnv.SweepInterval
+	c.AnalyticsBatchSize = cEnv.AnalyticsBatchSize
+	c.AnalyticsFlushInterval = cEnv.AnalyticsFlushInterval
+	c.AnalyticsSalt = cEnv.AnalyticsSalt
+	c.DeleteResumeInterval = cEnv.DeleteResumeInterval
+	c.ShutdownTimeout = cEnv.ShutdownTimeout
+	c.DrainTimeout = cEnv.DrainTimeout
+	c.CookieKeys = cEnv.CookieKeys
+	c.CookieTTL = cEnv.CookieTTL
+	if cEnv.CookieKeysFile != "" {
+		c.CookieKeysFile = cEnv.CookieKeysFile
+	}
+	if c.URLSchemes == "" || cEnv.URLSchemes != "http,https" {
+		c.URLSchemes = cEnv.URLSchemes
+	}
+	if cEnv.URLBlocklist != "" {
+		c.URLBlocklist = cEnv.URLBlocklist
+	}
 	if cEnv.Database != "" {
 		c.Database = cEnv.Database
 	}
 	if c.ServerAddress == "" || cEnv.ServerAddress != "localhost:8080" {
 		c.ServerAddress = cEnv.ServerAddress
 	}
+	if c.FileSync == "" || cEnv.FileSync != "interval" {
+		c.FileSync = cEnv.FileSync
+	}
+	if cEnv.GRPCAddress != "" {
+		c.GRPCAddress = cEnv.GRPCAddress
+	}
+	if c.TLSCertFile == "" || cEnv.TLSCertFile != "server.crt" {
+		c.TLSCertFile = cEnv.TLSCertFile
+	}
+	if c.TLSKeyFile == "" || cEnv.TLSKeyFile != "server.key" {
+		c.TLSKeyFile = cEnv.TLSKeyFile
+	}
+	if c.ACMECacheDir == "" || cEnv.ACMECacheDir != "certs" {
+		c.ACMECacheDir = cEnv.ACMECacheDir
+	}
+	if cEnv.ACMEDomains != "" {
+		c.ACMEDomains = cEnv.ACMEDomains
+	}
+	c.TLSSelfSigned = c.TLSSelfSigned || cEnv.TLSSelfSigned
+	c.ACMEDirectoryURL = cEnv.ACMEDirectoryURL
+	c.ACMEEmail = cEnv.ACMEEmail
+	if cEnv.TrustedSubnet != "" {
+		c.TrustedSubnet = cEnv.TrustedSubnet
+	}
+	if cEnv.TrustedProxies != "" {
+		c.TrustedProxies = cEnv.TrustedProxies
+	}
 	if cEnv.BaseURL != "" {
 		c.BaseURL = cEnv.BaseURL
 	}
 	if cEnv.FileStoragePath != "" {
 		c.FileStoragePath = cEnv.FileStoragePath
 	}
-	bu := flag.String(paramNames["BASE_URL"], "", "")
-	sa := flag.String(paramNames["SERVER_ADDRESS"], "", "")
-	fs := flag.String(paramNames["FILE_STORAGE_PATH"], "", "")
-	db := flag.String(paramNames["DATABASE_DSN"], "", "")
-	tls := flag.Bool(paramNames["ENABLE_HTTPS"], false, "")
-
-	flag.Parse()
-	if *bu != "" {
+	if set[paramNames["BASE_URL"]] {
 		c.BaseURL = *bu
 	}
-	if *sa != "" {
+	if set[paramNames["SERVER_ADDRESS"]] {
 		c.ServerAddress = *sa
 	}
-	if *fs != "" {
+	if set[paramNames["FILE_STORAGE_PATH"]] {
 		c.FileStoragePath = *fs
 	}
-	if *db != "" {
+	if set[paramNames["DATABASE_DSN"]] {
 		c.Database = *db
 	}
-	if tls != nil {
+	if set[paramNames["GRPC_ADDRESS"]] {
+		c.GRPCAddress = *ga
+	}
+	if set[paramNames["TRUSTED_SUBNET"]] {
+		c.TrustedSubnet = *ts
+	}
+	if set[paramNames["ENABLE_HTTPS"]] {
 		c.EnableHTTPS = *tls
 	}
 	return c
@@ -10,8 +10,21 @@ type ConfigFile struct {
 	ServerAddress   string `json:"server_address"`
 	BaseURL         string `json:"base_url"`
 	FileStoragePath string `json:"file_storage_path"`
+	FileSync        string `json:"file_sync"`
 	DatabaseDSN     string `json:"database_dsn"`
 	EnableHTTPS     bool   `json:"enable_https"`
+	CookieKeysFile  string `json:"cookie_keys_file"`
+	GRPCAddress     string `json:"grpc_address"`
+	TrustedSubnet   string `json:"trusted_subnet"`
+	TrustedProxies  string `json:"trusted_proxies"`
+	TLSCertFile     string `json:"tls_cert_file"`
+	TLSKeyFile      string `json:"tls_key_file"`
+	TLSSelfSigned   bool   `json:"tls_self_signed"`
+	ACMEDomains     string `json:"acme_domains"`
+	ACMECacheDir    string `json:"acme_cache_dir"`
+	URLSchemes      string `json:"url_schemes"`
+	URLBlocklist    string `json:"url_blocklist_file"`
+	URLResolve      bool   `json:"url_resolve"`
 }
 
 func getConfigFromFIle(fileName string) (Config, error) {
@@ -30,10 +43,23 @@ func getConfigFromFIle(fileName string) (Config, error) {
 	}
 
 	return Config{
-		ServerAddress: cfg.ServerAddress,
-		BaseURL:       cfg.BaseURL,
-		FileStoragePath:      cfg.FileStoragePath,
-		EnableHTTPS:   cfg.EnableHTTPS,
-		Database: cfg.DatabaseDSN,
+		ServerAddress:   cfg.ServerAddress,
+		BaseURL:         cfg.BaseURL,
+		FileStoragePath: cfg.FileStoragePath,
+		FileSync:        cfg.FileSync,
+		EnableHTTPS:     cfg.EnableHTTPS,
+		Database:        cfg.DatabaseDSN,
+		CookieKeysFile:  cfg.CookieKeysFile,
+		GRPCAddress:     cfg.GRPCAddress,
+		TrustedSubnet:   cfg.TrustedSubnet,
+		TrustedProxies:  cfg.TrustedProxies,
+		TLSCertFile:     cfg.TLSCertFile,
+		TLSKeyFile:      cfg.TLSKeyFile,
+		TLSSelfSigned:   cfg.TLSSelfSigned,
+		ACMEDomains:     cfg.ACMEDomains,
+		ACMECacheDir:    cfg.ACMECacheDir,
+		URLSchemes:      cfg.URLSchemes,
+		URLBlocklist:    cfg.URLBlocklist,
+		URLResolve:      cfg.URLResolve,
 	}, nil
-}
\ No newline at end of file
+}
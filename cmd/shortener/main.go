@@ -2,19 +2,38 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"ilyakasharokov/cmd/shortener/configuration"
+	"ilyakasharokov/internal/app/analytics"
 	"ilyakasharokov/internal/app/apiserver"
-	"ilyakasharokov/internal/app/repositorydb"
+	"ilyakasharokov/internal/app/cache"
+	"ilyakasharokov/internal/app/certificate"
+	"ilyakasharokov/internal/app/deletion"
+	helpers "ilyakasharokov/internal/app/encryptor"
+	"ilyakasharokov/internal/app/grpcserver"
+	"ilyakasharokov/internal/app/logger"
+	"ilyakasharokov/internal/app/metrics"
+	"ilyakasharokov/internal/app/middlewares"
+	"ilyakasharokov/internal/app/migrations"
+	"ilyakasharokov/internal/app/ratelimit"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/shutdown"
+	"ilyakasharokov/internal/app/storage"
+	"ilyakasharokov/internal/app/urlcheck"
 	"ilyakasharokov/internal/app/worker"
-	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
 	"syscall"
 
-	_ "github.com/lib/pq"
-
 	"os"
 	"os/signal"
-	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 var (
@@ -24,37 +43,250 @@ var (
 )
 
 func main() {
-	log.Printf("Build version: %v\n", buildVersion)
-	log.Printf("Build date: %v\n", buildDate)
-	log.Printf("Build commit: %v\n", buildCommit)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	cfg := configuration.New()
-	db, err := sql.Open("postgres", cfg.Database)
+	if err := logger.Init(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatal().Err(err).Msg("Logger config error")
+	}
+	log.Info().Str("version", buildVersion).Str("date", buildDate).Str("commit", buildCommit).Msg("Build info")
+	if flag.Arg(0) == "migrate" {
+		migrate(ctx, cfg, flag.Arg(1))
+		return
+	}
+	gen, err := shortcode.New(cfg.ShortCodeGenerator, cfg.ShortCodeLength)
+	if err != nil {
+		log.Err(err).Msg("Short code generator error")
+		return
+	}
+	codes := shortcode.NewAllocator(gen, cfg.ShortCodeAttempts)
+	canonical := urlcheck.Rules{SortQuery: cfg.URLSortQuery}
+	if cfg.URLStripTracking {
+		canonical.StripParams = append(canonical.StripParams, urlcheck.TrackingParams...)
+	}
+	if cfg.URLStripParams != "" {
+		canonical.StripParams = append(canonical.StripParams, strings.Split(cfg.URLStripParams, ",")...)
+	}
+	check, err := urlcheck.New(cfg.BaseURL, urlcheck.Options{
+		Schemes:       strings.Split(cfg.URLSchemes, ","),
+		MaxLength:     cfg.URLMaxLength,
+		BlocklistFile: cfg.URLBlocklist,
+		Resolve:       cfg.URLResolve,
+		Canonical:     canonical,
+	})
+	if err != nil {
+		log.Err(err).Msg("URL check config error")
+		return
+	}
+	store, err := storage.New(cfg, codes)
+	if err != nil {
+		log.Err(err).Msg("Storage error")
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Err(err).Msg("Close storage error")
+		}
+	}()
+	if store.DB != nil {
+		m, err := migrations.New(store.DB)
+		if err == nil {
+			err = m.Up(ctx)
+		}
+		if err != nil {
+			log.Err(err).Msg("Migrations error")
+			return
+		}
+	}
+	keys, err := cookieKeys(cfg)
+	if err != nil {
+		log.Err(err).Msg("Cookie keys error")
+		return
+	}
+	var trusted *net.IPNet
+	if cfg.TrustedSubnet != "" {
+		_, trusted, err = net.ParseCIDR(cfg.TrustedSubnet)
+		if err != nil {
+			log.Err(err).Msg("Trusted subnet error")
+			return
+		}
+	}
+	proxies, err := middlewares.ParseProxies(cfg.TrustedProxies)
 	if err != nil {
+		log.Err(err).Msg("Trusted proxies error")
 		return
 	}
-	defer db.Close()
-	repo := repositorydb.New(db)
+	m := metrics.New()
+	if store.DB != nil {
+		m.WatchDB(store.DB)
+	}
+	repo := store.Repo
+	if cfg.CacheSize > 0 {
+		c := cache.New(repo, cfg.CacheSize, cfg.CacheTTL, cfg.CacheNegativeTTL)
+		m.WatchCache(c)
+		repo = c
+	}
+	// Пул живет дольше ctx, чтобы при остановке выполнить очередь задач.
+	poolCtx, stopPool := context.WithCancel(context.Background())
+	defer stopPool()
 	wp := worker.New(5, 5)
-	go wp.Run(ctx)
-	s := apiserver.New(repo, cfg.ServerAddress, cfg.BaseURL, db, wp)
+	m.WatchPool(wp)
+	go wp.Run(poolCtx)
+	var background sync.WaitGroup
+	goBackground := func(f func()) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			f()
+		}()
+	}
+	goBackground(func() {
+		wp.Every(ctx, cfg.SweepInterval, func(ctx context.Context) error {
+			removed, err := repo.RemoveExpired(ctx)
+			if removed > 0 {
+				log.Info().Int64("removed", removed).Msg("Expired links removed")
+			}
+			return err
+		})
+	})
+	jobs := deletion.New(store.Jobs, repo, wp)
+	goBackground(func() { jobs.Run(ctx, cfg.DeleteResumeInterval) })
+	clicks := analytics.New(store.Clicks, wp, cfg.AnalyticsBatchSize, cfg.AnalyticsFlushInterval, cfg.AnalyticsSalt)
+	goBackground(func() { clicks.Run(ctx) })
+	tlsConfig, certs, err := serverTLS(cfg)
+	if err != nil {
+		log.Err(err).Msg("TLS config error")
+		return
+	}
+	limits := apiserver.RateLimits{
+		Store:    ratelimit.NewMemory(),
+		Create:   ratelimit.Limit{Rate: cfg.RateCreateRPS, Burst: cfg.RateCreateBurst},
+		Redirect: ratelimit.Limit{Rate: cfg.RateRedirectRPS, Burst: cfg.RateRedirectBurst},
+	}
+	if cfg.RateLimitShared {
+		if store.DB == nil {
+			log.Warn().Msg("RATE_LIMIT_SHARED needs DATABASE_DSN, rate limits stay in memory")
+		} else {
+			shared := ratelimit.NewPostgres(store.DB)
+			limits.Store = shared
+			// корзины, не тронутые дольше времени заполнения, полные и не нужны
+			idle := limits.Create.FillTime()
+			if t := limits.Redirect.FillTime(); t > idle {
+				idle = t
+			}
+			goBackground(func() {
+				wp.Every(ctx, cfg.SweepInterval, func(ctx context.Context) error {
+					_, err := shared.Sweep(ctx, idle)
+					return err
+				})
+			})
+		}
+	}
+	s := apiserver.New(repo, codes, check, clicks, store.Clicks, cfg.ServerAddress, cfg.BaseURL, store.DB, jobs, keys, trusted, proxies, m, limits)
 	go func() {
-		log.Println(s.Start(cfg.EnableHTTPS))
+		if err := s.Start(tlsConfig); !errors.Is(err, http.ErrServerClosed) {
+			log.Err(err).Msg("HTTP server error")
+		}
 		cancel()
 	}()
+	var g *grpcserver.Server
+	if cfg.GRPCAddress != "" {
+		g = grpcserver.New(repo, codes, check, jobs, keys, cfg.GRPCAddress, cfg.BaseURL, store.DB, tlsConfig)
+		go func() {
+			if err := g.Start(); err != nil {
+				log.Err(err).Msg("gRPC server error")
+			}
+			cancel()
+		}()
+	}
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint,
 		os.Interrupt,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
-	select {
-	case <-sigint:
-		cancel()
-	case <-ctx.Done():
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case <-hup:
+			if certs == nil {
+				continue
+			}
+			if err := certs.Reload(); err != nil {
+				log.Err(err).Msg("Certificate reload error")
+			} else {
+				log.Info().Msg("Certificate reloaded")
+			}
+		case <-sigint:
+			break wait
+		case <-ctx.Done():
+			break wait
+		}
+	}
+	err = shutdown.Run(
+		// перестаем принимать запросы и ждем текущие
+		shutdown.Phase{Name: "http", Timeout: cfg.ShutdownTimeout, Run: s.Cancel},
+		shutdown.Phase{Name: "grpc", Timeout: cfg.ShutdownTimeout, Run: func(ctx context.Context) error {
+			if g == nil {
+				return nil
+			}
+			return g.Cancel(ctx)
+		}},
+		// останавливаем фоновые задачи, сборщик переходов сохраняет остаток
+		shutdown.Phase{Name: "background", Timeout: cfg.ShutdownTimeout, Run: func(context.Context) error {
+			cancel()
+			background.Wait()
+			return nil
+		}},
+		shutdown.Phase{Name: "workers", Timeout: cfg.DrainTimeout, Run: wp.Shutdown},
+		shutdown.Phase{Name: "storage", Timeout: cfg.ShutdownTimeout, Run: func(ctx context.Context) error {
+			// прерываем задачи, не успевшие выполниться, и ждем воркеры, чтобы они не писали в закрытое хранилище
+			if stats := wp.Stats(); stats.Queued > 0 || stats.Busy > 0 {
+				log.Warn().Int("queued", stats.Queued).Int64("busy", stats.Busy).Msg("Abandoning worker tasks")
+			}
+			stopPool()
+			if err := wp.Shutdown(ctx); err != nil {
+				return fmt.Errorf("workers did not stop, storage left open: %w", err)
+			}
+			return store.Close()
+		}},
+	)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Shutdown error")
+	}
+	log.Info().Msg("Server stopped")
+}
+
+// cookieKeys загружает ключи подписи кук. Без настроенных ключей используется случайный,
+// и после перезапуска все пользователи получат новые идентификаторы.
+func cookieKeys(cfg configuration.Config) (*helpers.Keyring, error) {
+	if cfg.CookieKeys == "" && cfg.CookieKeysFile == "" {
+		log.Warn().Msg("COOKIE_KEYS is not set, cookies will not survive restart")
+		return helpers.RandomKeyring(cfg.CookieTTL)
+	}
+	return helpers.LoadKeyring(cfg.CookieKeys, cfg.CookieKeysFile, cfg.CookieTTL)
+}
+
+// serverTLS собирает настройки HTTPS, без ENABLE_HTTPS возвращает nil.
+// Сертификат из фаилов перечитывается через возвращаемый Reloader.
+func serverTLS(cfg configuration.Config) (*tls.Config, *certificate.Reloader, error) {
+	if !cfg.EnableHTTPS {
+		return nil, nil, nil
+	}
+	var domains []string
+	for _, domain := range strings.Split(cfg.ACMEDomains, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
 	}
-	ctxt, cancelt := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelt()
-	s.Cancel(ctxt)
+	return certificate.TLSConfig(certificate.Options{
+		CertFile:      cfg.TLSCertFile,
+		KeyFile:       cfg.TLSKeyFile,
+		SelfSigned:    cfg.TLSSelfSigned,
+		ACMEDomains:   domains,
+		ACMECacheDir:  cfg.ACMECacheDir,
+		ACMEDirectory: cfg.ACMEDirectoryURL,
+		ACMEEmail:     cfg.ACMEEmail,
+	})
 }
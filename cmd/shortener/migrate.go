@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"ilyakasharokov/cmd/shortener/configuration"
+	"ilyakasharokov/internal/app/migrations"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// migrate выполняет подкоманду shortener migrate up|down|status.
+func migrate(ctx context.Context, cfg configuration.Config, command string) {
+	if cfg.Database == "" {
+		log.Fatal().Msg("migrate: DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", cfg.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("migrate")
+	}
+	defer db.Close()
+	m, err := migrations.New(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("migrate")
+	}
+	switch command {
+	case "up":
+		err = m.Up(ctx)
+	case "down":
+		err = m.Down(ctx)
+	case "status":
+		var statuses []migrations.Status
+		statuses, err = m.Status(ctx)
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", s.Version, s.Name, applied)
+		}
+	default:
+		err = fmt.Errorf("migrate: unknown command %q, use up, down or status", command)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("migrate")
+	}
+}
@@ -0,0 +1,138 @@
+// Сбор переходов по коротким ссылкам. Переходы буферизуются и сохраняются пакетами через пул воркеров.
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"ilyakasharokov/internal/app/middlewares"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/worker"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// flushTimeout время на сохранение остатка переходов при остановке.
+const flushTimeout = 5 * time.Second
+
+// Store хранилище переходов.
+type Store interface {
+	SaveClicks(context.Context, []model.Click) error
+}
+
+type Collector struct {
+	store     Store
+	wp        *worker.WorkerPool
+	events    chan model.Click
+	batchSize int
+	interval  time.Duration
+	salt      []byte
+	dropped   uint64
+}
+
+// New создает сборщик. Пакет сохраняется при накоплении batchSize переходов или раз в interval.
+// Пустая соль заменяется случайной, тогда уникальные посетители считаются только в пределах запуска.
+func New(store Store, wp *worker.WorkerPool, batchSize int, interval time.Duration, salt string) *Collector {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	key := []byte(salt)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Err(err).Msg("Analytics salt error")
+		}
+	}
+	return &Collector{
+		store:     store,
+		wp:        wp,
+		events:    make(chan model.Click, batchSize*10),
+		batchSize: batchSize,
+		interval:  interval,
+		salt:      key,
+	}
+}
+
+// Record ставит переход в буфер без блокировки. При переполненном буфере переход отбрасывается.
+func (c *Collector) Record(r *http.Request, short string) {
+	click := model.Click{
+		Short:     short,
+		At:        time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPHash:    c.hashIP(middlewares.RealIP(r).String()),
+	}
+	select {
+	case c.events <- click:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+	}
+}
+
+// Dropped число отброшенных из-за переполнения буфера переходов.
+func (c *Collector) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+func (c *Collector) hashIP(ip string) string {
+	mac := hmac.New(sha256.New, c.salt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run копит переходы и отдает пакеты в пул воркеров до отмены ctx.
+// После отмены оставшиеся переходы сохраняются напрямую.
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	batch := make([]model.Click, 0, c.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		clicks := batch
+		batch = make([]model.Click, 0, c.batchSize)
+		err := c.wp.PushContext(ctx, func(ctx context.Context) error {
+			return c.store.SaveClicks(ctx, clicks)
+		})
+		if err != nil {
+			// пул остановлен, пакет сохранится вместе с остатком
+			batch = append(clicks, batch...)
+		}
+	}
+	for {
+		select {
+		case click := <-c.events:
+			batch = append(batch, click)
+			if len(batch) >= c.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case click := <-c.events:
+					batch = append(batch, click)
+				default:
+					break drain
+				}
+			}
+			if len(batch) == 0 {
+				return
+			}
+			saveCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+			if err := c.store.SaveClicks(saveCtx, batch); err != nil {
+				log.Err(err).Int("clicks", len(batch)).Msg("Save clicks error")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package analytics
+
+import (
+	"context"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/worker"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testStore запоминает сохраненные пакеты.
+type testStore struct {
+	mu      sync.Mutex
+	batches [][]model.Click
+}
+
+func (s *testStore) SaveClicks(_ context.Context, clicks []model.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, clicks)
+	return nil
+}
+
+func (s *testStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, b := range s.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestCollector_Batch(t *testing.T) {
+	store := new(testStore)
+	wp := worker.New(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wp.Run(ctx)
+	c := New(store, wp, 2, time.Hour, "salt")
+	go c.Run(ctx)
+
+	r := httptest.NewRequest("GET", "/abc", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	c.Record(r, "abc")
+	// заголовки клиента без доверенного прокси не меняют адрес посетителя
+	r.Header.Set("X-Real-IP", "203.0.113.1")
+	r.Header.Set("X-Forwarded-For", "203.0.113.2")
+	c.Record(r, "abc")
+	assert.Eventually(t, func() bool { return store.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	batch := store.batches[0]
+	assert.Equal(t, "abc", batch[0].Short)
+	assert.Equal(t, batch[0].IPHash, batch[1].IPHash)
+	assert.NotContains(t, batch[0].IPHash, "10.0.0.1")
+}
+
+func TestCollector_FlushOnStop(t *testing.T) {
+	store := new(testStore)
+	// пул не запущен, остаток сохраняется напрямую
+	c := New(store, worker.New(1, 1), 100, time.Hour, "salt")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	r := httptest.NewRequest("GET", "/abc", nil)
+	for i := 0; i < 3; i++ {
+		c.Record(r, "abc")
+	}
+	cancel()
+	<-done
+	assert.Equal(t, 3, store.count())
+}
+
+func TestCollector_Dropped(t *testing.T) {
+	c := New(new(testStore), worker.New(1, 1), 1, time.Hour, "salt")
+	r := httptest.NewRequest("GET", "/abc", nil)
+	for i := 0; i < 11; i++ {
+		c.Record(r, "abc")
+	}
+	assert.EqualValues(t, 1, c.Dropped())
+}
@@ -3,12 +3,17 @@ package apiserver
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
-	"ilyakasharokov/internal/app/certificate"
+	"ilyakasharokov/internal/app/analytics"
+	helpers "ilyakasharokov/internal/app/encryptor"
 	"ilyakasharokov/internal/app/handlers"
+	"ilyakasharokov/internal/app/metrics"
 	"ilyakasharokov/internal/app/middlewares"
-	"ilyakasharokov/internal/app/repositorydb"
-	"ilyakasharokov/internal/app/worker"
+	"ilyakasharokov/internal/app/ratelimit"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/urlcheck"
+	"net"
 	"net/http"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -17,24 +22,41 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// RateLimits ограничения частоты создания ссылок и редиректов.
+type RateLimits struct {
+	Store    ratelimit.Store
+	Create   ratelimit.Limit
+	Redirect ratelimit.Limit
+}
+
 type APIServer struct {
-	repo repositorydb.RepositoryDB
+	repo handlers.RepoDBModel
 	srv  *http.Server
 	db   *sql.DB
 }
 
-func New(repo *repositorydb.RepositoryDB, serverAddress string, baseURL string, database *sql.DB, wp *worker.WorkerPool) *APIServer {
+func New(repo handlers.RepoDBModel, codes *shortcode.Allocator, check *urlcheck.Checker, clicks *analytics.Collector, stats handlers.ClickStatsModel, serverAddress string, baseURL string, database *sql.DB, jobs handlers.DeleteQueue, keys *helpers.Keyring, trusted *net.IPNet, proxies []*net.IPNet, m *metrics.Metrics, limits RateLimits) *APIServer {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middlewares.TrustedProxies(proxies))
+	r.Use(m.Middleware)
+	r.Use(middlewares.RequestLogger)
 	r.Use(middlewares.GzipHandle)
-	r.Use(middlewares.CookieMiddleware)
-	r.Post("/", handlers.CreateShort(repo, baseURL))
-	r.Post("/api/shorten", handlers.APICreateShort(repo, baseURL))
-	r.Post("/api/shorten/batch", handlers.BunchSaveJSON(repo, baseURL))
-	r.Get("/{id:[0-9a-zA-z]+}", handlers.GetShort(repo))
+	r.Use(middlewares.Cookie(keys))
+	create := ratelimit.Middleware(limits.Store, "create", limits.Create)
+	r.With(create).Post("/", handlers.CreateShort(repo, codes, check, baseURL))
+	r.With(create).Post("/api/shorten", handlers.APICreateShort(repo, codes, check, baseURL))
+	r.With(create).Post("/api/shorten/batch", handlers.BunchSaveJSON(repo, check, baseURL))
+	r.With(create).Post("/api/shorten/import", handlers.Import(repo, check, baseURL))
+	r.With(m.Redirects, ratelimit.Middleware(limits.Store, "redirect", limits.Redirect)).Get("/{id:"+handlers.CodePattern+"}", handlers.GetShort(repo, clicks))
 	r.Get("/user/urls", handlers.GetUserShorts(repo))
+	r.Get("/api/user/urls/{short}/stats", handlers.Stats(repo, stats))
 	r.Get("/ping", handlers.Ping(database))
-	r.Delete("/api/user/urls", handlers.Delete(repo, wp))
+	r.With(middlewares.TrustedSubnet(trusted)).Get("/api/internal/stats", handlers.InternalStats(repo))
+	r.Delete("/api/user/urls", handlers.Delete(jobs))
+	r.Get("/api/user/urls/delete/{job}", handlers.DeleteStatus(jobs))
 
+	r.Handle("/metrics", m.Handler())
 	r.Mount("/debug/", middleware.Profiler())
 
 	srv := &http.Server{
@@ -42,7 +64,7 @@ func New(repo *repositorydb.RepositoryDB, serverAddress string, baseURL string,
 		Handler: r,
 	}
 	return &APIServer{
-		repo: *repo,
+		repo: repo,
 		srv:  srv,
 	}
 }
@@ -51,25 +73,13 @@ func (s *APIServer) Cancel(ctx context.Context) error {
 	return s.srv.Shutdown(ctx)
 }
 
-func (s *APIServer) Start(https bool) error {
-	if https {
-		log.Info().Msg("Start https server on " + s.srv.Addr)
-		err := certificate.Create()
-		if err != nil {
-			return err
-		}
-		return s.srv.ListenAndServeTLS("server.crt", "server.key")
-	}else{
+// Start запускает сервер. С tlsConfig сервер работает по HTTPS.
+func (s *APIServer) Start(tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
 		log.Info().Msg("Start http server on " + s.srv.Addr)
 		return s.srv.ListenAndServe()
 	}
-}
-
-func (s *APIServer) StartTLS() error {
 	log.Info().Msg("Start https server on " + s.srv.Addr)
-	err := certificate.Create()
-	if err != nil {
-		return err
-	}
-	return s.srv.ListenAndServeTLS("server.crt", "server.key")
-}
\ No newline at end of file
+	s.srv.TLSConfig = tlsConfig
+	return s.srv.ListenAndServeTLS("", "")
+}
@@ -1,9 +1,9 @@
-// Base62 декодер
+// Base62 кодер/декодер
 package base62
 
 import (
+	"errors"
 	"math"
-	"strconv"
 	"strings"
 )
 
@@ -12,17 +12,50 @@ const (
 	length   = uint64(len(alphabet))
 )
 
-func Decode(encoded string) (string, error) {
-	var number uint64
+var (
+	ErrInvalidSymbol = errors.New("base62: invalid symbol")
+	ErrOverflow      = errors.New("base62: value overflows uint64")
+)
 
-	for i, symbol := range encoded {
-		alphabeticPosition := strings.IndexRune(alphabet, symbol)
+// Encode кодирует число в строку base62, старший разряд первым.
+func Encode(number uint64) string {
+	if number == 0 {
+		return alphabet[:1]
+	}
+	var b []byte
+	for number > 0 {
+		b = append(b, alphabet[number%length])
+		number /= length
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
 
-		if alphabeticPosition == -1 {
-			continue
+// Decode декодирует строку base62, полученную Encode, обратно в число.
+func Decode(encoded string) (uint64, error) {
+	if encoded == "" {
+		return 0, ErrInvalidSymbol
+	}
+	var number uint64
+	for _, symbol := range encoded {
+		position := strings.IndexRune(alphabet, symbol)
+		if position == -1 {
+			return 0, ErrInvalidSymbol
+		}
+		if number > (math.MaxUint64-uint64(position))/length {
+			return 0, ErrOverflow
 		}
-		number += uint64(alphabeticPosition) * uint64(math.Pow(float64(length), float64(i)))
+		number = number*length + uint64(position)
 	}
+	return number, nil
+}
 
-	return strconv.FormatUint(number, 10), nil
+// Pad дополняет код нулевым символом алфавита слева до длины size.
+func Pad(encoded string, size int) string {
+	if len(encoded) >= size {
+		return encoded
+	}
+	return strings.Repeat(alphabet[:1], size-len(encoded)) + encoded
 }
@@ -2,10 +2,31 @@ package base62
 
 import (
 	"fmt"
-	helpers "ilyakasharokov/internal/app/encryptor"
+	"math"
+	"math/rand"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		number uint64
+		want   string
+	}{
+		{name: "zero", number: 0, want: "a"},
+		{name: "one digit", number: 61, want: "9"},
+		{name: "two digits", number: 62, want: "ba"},
+		{name: "max", number: math.MaxUint64, want: "v8QrKbgkrIp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Encode(tt.number))
+		})
+	}
+}
+
 func TestDecode(t *testing.T) {
 	type args struct {
 		encoded string
@@ -13,39 +34,63 @@ func TestDecode(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    string
-		wantErr bool
+		want    uint64
+		wantErr error
 	}{
-		// TODO: Add test cases.
+		{name: "zero", args: args{"a"}, want: 0},
+		{name: "two digits", args: args{"ba"}, want: 62},
+		{name: "padded", args: args{"aaba"}, want: 62},
+		{name: "max", args: args{"v8QrKbgkrIp"}, want: math.MaxUint64},
+		{name: "overflow", args: args{"v8QrKbgkrIq"}, wantErr: ErrOverflow},
+		{name: "invalid symbol", args: args{"ab-c"}, wantErr: ErrInvalidSymbol},
+		{name: "empty", args: args{""}, wantErr: ErrInvalidSymbol},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := Decode(tt.args.encoded)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
-				t.Errorf("Decode() got = %v, want %v", got, tt.want)
-			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
 
-func ExampleDecode() {
-	url := helpers.RandomString(10)
-	decoded, err := Decode(url)
-	fmt.Println(decoded, err)
+func TestRoundTrip(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		number := rand.Uint64()
+		decoded, err := Decode(Encode(number))
+		assert.NoError(t, err)
+		assert.Equal(t, number, decoded)
+
+		decoded, err = Decode(Pad(Encode(number), 12))
+		assert.NoError(t, err)
+		assert.Equal(t, number, decoded)
+	}
+}
+
+func ExampleEncode() {
+	encoded := Encode(125)
+	decoded, err := Decode(encoded)
+	fmt.Println(encoded, decoded, err)
 
-	// Output
-	// "decodedstring" nil
+	// Output:
+	// cb 125 <nil>
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Encode(uint64(i))
+	}
 }
 
 func BenchmarkDecode(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		url := helpers.RandomString(20)
+		encoded := Encode(rand.Uint64())
 		b.StartTimer()
-		Decode(url)
+		Decode(encoded)
 	}
 }
@@ -0,0 +1,229 @@
+// Кеш редиректов: декоратор репозитория с LRU по короткому коду.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"ilyakasharokov/internal/app/handlers"
+	"ilyakasharokov/internal/app/model"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache кеширует GetByShort поверх любого репозитория, включая отсутствующие коды.
+// Остальные методы передаются репозиторию, изменения через них сбрасывают затронутые записи.
+// Изменения в обход Cache, например с другого экземпляра сервиса, видны после истечения TTL.
+type Cache struct {
+	handlers.RepoDBModel
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// gen растет при каждом сбросе, чтобы не закешировать ответ репозитория, полученный до сброса.
+	gen uint64
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type entry struct {
+	key     string
+	link    model.Link
+	found   bool
+	expires time.Time
+}
+
+// New оборачивает repo кешем на size кодов. Найденные ссылки хранятся ttl, отсутствующие negativeTTL.
+func New(repo handlers.RepoDBModel, size int, ttl time.Duration, negativeTTL time.Duration) *Cache {
+	return &Cache{
+		RepoDBModel: repo,
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// Получение URL по короткому коду из кеша или репозитория.
+func (c *Cache) GetByShort(key string, ctx context.Context) (model.Link, error) {
+	link, found, gen, ok := c.get(key)
+	if ok {
+		atomic.AddInt64(&c.hits, 1)
+		if !found {
+			return model.Link{}, model.ErrNotFound
+		}
+		return link, nil
+	}
+	atomic.AddInt64(&c.misses, 1)
+	link, err := c.RepoDBModel.GetByShort(key, ctx)
+	switch {
+	case err == nil:
+		c.put(gen, key, link, true)
+	case errors.Is(err, model.ErrNotFound):
+		c.put(gen, key, model.Link{}, false)
+	}
+	return link, err
+}
+
+// Добавление URL, сбрасывает закешированное отсутствие кода.
+func (c *Cache) AddItem(user model.User, key string, link model.Link, ctx context.Context) error {
+	err := c.RepoDBModel.AddItem(user, key, link, ctx)
+	c.Invalidate(key)
+	return err
+}
+
+// Сохранение множества URL, сбрасывает закешированное отсутствие новых кодов.
+func (c *Cache) BunchSave(ctx context.Context, user model.User, links []model.Link) ([]model.ShortLink, error) {
+	shorts, err := c.RepoDBModel.BunchSave(ctx, user, links)
+	keys := make([]string, 0, len(links))
+	for _, short := range shorts {
+		keys = append(keys, short.Short)
+	}
+	for _, link := range links {
+		keys = append(keys, link.Alias)
+	}
+	c.Invalidate(keys...)
+	return shorts, err
+}
+
+// Пометка удаленными ссылок пользователя, сбрасывает их по коду и по числовому id.
+func (c *Cache) RemoveItems(ctx context.Context, user model.User, items []string) (int64, error) {
+	removed, err := c.RepoDBModel.RemoveItems(ctx, user, items)
+	c.invalidateItems(items)
+	return removed, err
+}
+
+// Пометка удаленными ссылок с истекшим сроком, сбрасывает истекшие записи.
+func (c *Cache) RemoveExpired(ctx context.Context) (int64, error) {
+	removed, err := c.RepoDBModel.RemoveExpired(ctx)
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, el := range c.entries {
+		if e := el.Value.(*entry); e.found && e.link.Expired(now) {
+			c.remove(el)
+		}
+	}
+	return removed, err
+}
+
+// Статистика сервиса вместе со счетчиками кеша.
+func (c *Cache) ServiceStats(ctx context.Context) (model.ServiceStats, error) {
+	stats, err := c.RepoDBModel.ServiceStats(ctx)
+	if err != nil {
+		return stats, err
+	}
+	cs := c.Stats()
+	stats.Cache = &cs
+	return stats, nil
+}
+
+// Stats счетчики кеша.
+func (c *Cache) Stats() model.CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return model.CacheStats{
+		Hits:      atomic.LoadInt64(&c.hits),
+		Misses:    atomic.LoadInt64(&c.misses),
+		Evictions: atomic.LoadInt64(&c.evictions),
+		Size:      int64(size),
+	}
+}
+
+// Invalidate сбрасывает записи по коротким кодам.
+func (c *Cache) Invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, key := range keys {
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// invalidateItems сбрасывает записи по кодам и числовым id, как их принимает RemoveItems.
+func (c *Cache) invalidateItems(items []string) {
+	ids := make(map[string]bool)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, item := range items {
+		if el, ok := c.entries[item]; ok {
+			c.remove(el)
+			continue
+		}
+		if _, err := strconv.Atoi(item); err == nil {
+			ids[item] = true
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	for _, el := range c.entries {
+		if e := el.Value.(*entry); e.found && ids[strconv.Itoa(e.link.Seq)] {
+			c.remove(el)
+		}
+	}
+}
+
+// get возвращает запись и признак ее наличия, при отсутствии записи еще и текущее поколение для put.
+func (c *Cache) get(key string) (model.Link, bool, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return model.Link{}, false, c.gen, false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return model.Link{}, false, c.gen, false
+	}
+	c.lru.MoveToFront(el)
+	return e.link, e.found, c.gen, true
+}
+
+func (c *Cache) put(gen uint64, key string, link model.Link, found bool) {
+	ttl := c.ttl
+	if !found {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	e := &entry{key: key, link: link, found: found, expires: c.now().Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+		atomic.AddInt64(&c.evictions, 1)
+	}
+}
+
+// remove удаляет запись, вызывается под c.mu.
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).key)
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"ilyakasharokov/internal/app/handlers"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/repository"
+	"ilyakasharokov/internal/app/shortcode"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUser = model.User("default")
+
+// countingRepo считает обращения к GetByShort.
+type countingRepo struct {
+	handlers.RepoDBModel
+	calls int
+}
+
+func (r *countingRepo) GetByShort(key string, ctx context.Context) (model.Link, error) {
+	r.calls++
+	return r.RepoDBModel.GetByShort(key, ctx)
+}
+
+func newTest(t *testing.T, size int) (*Cache, *countingRepo) {
+	t.Helper()
+	repo := &countingRepo{RepoDBModel: repository.New("", shortcode.NewAllocator(shortcode.NewHash(8), 3))}
+	for i := 1; i <= 3; i++ {
+		key := "code" + strconv.Itoa(i)
+		require.NoError(t, repo.AddItem(testUser, key, model.Link{URL: "https://" + key + ".ru"}, context.Background()))
+	}
+	return New(repo, size, time.Minute, time.Second), repo
+}
+
+func TestCache_GetByShort(t *testing.T) {
+	ctx := context.Background()
+	c, repo := newTest(t, 10)
+	for i := 0; i < 3; i++ {
+		link, err := c.GetByShort("code1", ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "https://code1.ru", link.URL)
+		_, err = c.GetByShort("missing", ctx)
+		assert.ErrorIs(t, err, model.ErrNotFound)
+	}
+	assert.Equal(t, 2, repo.calls)
+	assert.Equal(t, model.CacheStats{Hits: 4, Misses: 2, Size: 2}, c.Stats())
+
+	stats, err := c.ServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &model.CacheStats{Hits: 4, Misses: 2, Size: 2}, stats.Cache)
+}
+
+func TestCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	c, repo := newTest(t, 10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	_, _ = c.GetByShort("code1", ctx)
+	_, _ = c.GetByShort("missing", ctx)
+
+	now = now.Add(2 * time.Second)
+	_, _ = c.GetByShort("code1", ctx)
+	_, _ = c.GetByShort("missing", ctx)
+	assert.Equal(t, 3, repo.calls, "negative entry expires first")
+
+	now = now.Add(time.Minute)
+	_, _ = c.GetByShort("code1", ctx)
+	assert.Equal(t, 4, repo.calls)
+}
+
+func TestCache_Evict(t *testing.T) {
+	ctx := context.Background()
+	c, repo := newTest(t, 2)
+	_, _ = c.GetByShort("code1", ctx)
+	_, _ = c.GetByShort("code2", ctx)
+	_, _ = c.GetByShort("code1", ctx)
+	_, _ = c.GetByShort("code3", ctx)
+	assert.EqualValues(t, 1, c.Stats().Evictions)
+
+	// code2 использовался давно и вытеснен, code1 остался
+	_, _ = c.GetByShort("code1", ctx)
+	assert.Equal(t, 3, repo.calls)
+	_, _ = c.GetByShort("code2", ctx)
+	assert.Equal(t, 4, repo.calls)
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		key    string
+		change func(c *Cache) error
+		check  func(t *testing.T, link model.Link, err error)
+	}{
+		{
+			name: "add after miss",
+			key:  "fresh",
+			change: func(c *Cache) error {
+				return c.AddItem(testUser, "fresh", model.Link{URL: "https://fresh.ru"}, ctx)
+			},
+			check: func(t *testing.T, link model.Link, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "https://fresh.ru", link.URL)
+			},
+		},
+		{
+			name: "batch alias after miss",
+			key:  "batch",
+			change: func(c *Cache) error {
+				_, err := c.BunchSave(ctx, testUser, []model.Link{{URL: "https://batch.ru", Alias: "batch"}})
+				return err
+			},
+			check: func(t *testing.T, link model.Link, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, "https://batch.ru", link.URL)
+			},
+		},
+		{
+			name: "remove by code",
+			key:  "code1",
+			change: func(c *Cache) error {
+				_, err := c.RemoveItems(ctx, testUser, []string{"code1"})
+				return err
+			},
+			check: func(t *testing.T, link model.Link, err error) {
+				require.NoError(t, err)
+				assert.True(t, link.Deleted)
+			},
+		},
+		{
+			name: "remove by id",
+			key:  "code2",
+			change: func(c *Cache) error {
+				_, err := c.RemoveItems(ctx, testUser, []string{"2"})
+				return err
+			},
+			check: func(t *testing.T, link model.Link, err error) {
+				require.NoError(t, err)
+				assert.True(t, link.Deleted)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTest(t, 10)
+			_, _ = c.GetByShort(tt.key, ctx)
+			require.NoError(t, tt.change(c))
+			link, err := c.GetByShort(tt.key, ctx)
+			tt.check(t, link, err)
+		})
+	}
+}
+
+// staleRepo удаляет ссылку через кеш, пока кеш ждет ответа репозитория.
+type staleRepo struct {
+	handlers.RepoDBModel
+	cache *Cache
+}
+
+func (r *staleRepo) GetByShort(key string, ctx context.Context) (model.Link, error) {
+	link, err := r.RepoDBModel.GetByShort(key, ctx)
+	if _, rerr := r.cache.RemoveItems(ctx, testUser, []string{key}); rerr != nil {
+		return link, rerr
+	}
+	return link, err
+}
+
+func TestCache_StaleRead(t *testing.T) {
+	ctx := context.Background()
+	c, repo := newTest(t, 10)
+	stale := &staleRepo{RepoDBModel: repo}
+	c.RepoDBModel = stale
+	stale.cache = c
+
+	link, err := c.GetByShort("code1", ctx)
+	require.NoError(t, err)
+	assert.False(t, link.Deleted)
+	assert.Zero(t, c.Stats().Size, "answer read before removal is not cached")
+}
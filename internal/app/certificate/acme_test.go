@@ -0,0 +1,241 @@
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+)
+
+// idPeACMEIdentifier расширение сертификата проверки TLS-ALPN-01, RFC 8737.
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// testCA минимальный ACME сервер по образцу Pebble. Подписи запросов не проверяются,
+// а вызов проверяется по-настоящему подключением к серверу с ALPN acme-tls/1.
+type testCA struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *ecdsa.PrivateKey
+	cert   *x509.Certificate
+	domain string
+	// addr адрес проверяемого сервера.
+	addr string
+
+	mu        sync.Mutex
+	validated bool
+	issued    []byte
+}
+
+func newTestCA(t *testing.T, domain string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	ca := &testCA{t: t, key: key, cert: cert, domain: domain}
+	ca.srv = httptest.NewServer(http.HandlerFunc(ca.handle))
+	t.Cleanup(ca.srv.Close)
+	return ca
+}
+
+func (ca *testCA) url(path string) string {
+	return ca.srv.URL + path
+}
+
+func (ca *testCA) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprint(time.Now().UnixNano()))
+	switch r.URL.Path {
+	case "/directory":
+		writeJSON(w, http.StatusOK, map[string]string{
+			"newNonce":   ca.url("/nonce"),
+			"newAccount": ca.url("/account"),
+			"newOrder":   ca.url("/order"),
+		})
+	case "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case "/account":
+		w.Header().Set("Location", ca.url("/account/1"))
+		writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case "/order":
+		w.Header().Set("Location", ca.url("/order/1"))
+		writeJSON(w, http.StatusCreated, ca.order())
+	case "/order/1":
+		w.Header().Set("Location", ca.url("/order/1"))
+		writeJSON(w, http.StatusOK, ca.order())
+	case "/authz/1":
+		status := "pending"
+		if ca.isValidated() {
+			status = "valid"
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": ca.domain},
+			"challenges": []interface{}{ca.challenge(status)},
+		})
+	case "/challenge/1":
+		ca.validate()
+		writeJSON(w, http.StatusOK, ca.challenge("processing"))
+	case "/finalize":
+		ca.finalize(r)
+		w.Header().Set("Location", ca.url("/order/1"))
+		writeJSON(w, http.StatusOK, ca.order())
+	case "/cert":
+		ca.mu.Lock()
+		chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.issued}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+		ca.mu.Unlock()
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(chain)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (ca *testCA) isValidated() bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.validated
+}
+
+func (ca *testCA) order() map[string]interface{} {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	o := map[string]interface{}{
+		"status":         "pending",
+		"identifiers":    []map[string]string{{"type": "dns", "value": ca.domain}},
+		"authorizations": []string{ca.url("/authz/1")},
+		"finalize":       ca.url("/finalize"),
+	}
+	if ca.validated {
+		o["status"] = "ready"
+	}
+	if ca.issued != nil {
+		o["status"] = "valid"
+		o["certificate"] = ca.url("/cert")
+	}
+	return o
+}
+
+func (ca *testCA) challenge(status string) map[string]string {
+	return map[string]string{"type": "tls-alpn-01", "url": ca.url("/challenge/1"), "token": "token", "status": status}
+}
+
+// validate подключается к серверу как ACME сервер при проверке TLS-ALPN-01.
+func (ca *testCA) validate() {
+	conn, err := tls.Dial("tcp", ca.addr, &tls.Config{
+		ServerName:         ca.domain,
+		NextProtos:         []string{acme.ALPNProto},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		ca.t.Log(err)
+		return
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != acme.ALPNProto {
+		ca.t.Logf("negotiated %q", state.NegotiatedProtocol)
+		return
+	}
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if ext.Id.Equal(idPeACMEIdentifier) {
+			ca.mu.Lock()
+			ca.validated = true
+			ca.mu.Unlock()
+		}
+	}
+}
+
+func (ca *testCA) finalize(r *http.Request) {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	require.NoError(ca.t, json.NewDecoder(r.Body).Decode(&jws))
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	require.NoError(ca.t, err)
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	require.NoError(ca.t, json.Unmarshal(payload, &req))
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	require.NoError(ca.t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(ca.t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: ca.domain},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	issued, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, csr.PublicKey, ca.key)
+	require.NoError(ca.t, err)
+	ca.mu.Lock()
+	ca.issued = issued
+	ca.mu.Unlock()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestTLSConfig_ACME(t *testing.T) {
+	const domain = "short.example"
+	ca := newTestCA(t, domain)
+	cacheDir := t.TempDir()
+	cfg, reloader, err := TLSConfig(Options{
+		ACMEDomains:   []string{domain},
+		ACMECacheDir:  cacheDir,
+		ACMEDirectory: ca.url("/directory"),
+	})
+	require.NoError(t, err)
+	assert.Nil(t, reloader)
+	ca.addr = serve(t, cfg)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	conn, err := tls.Dial("tcp", ca.addr, &tls.Config{ServerName: domain, RootCAs: roots})
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, []string{domain}, conn.ConnectionState().PeerCertificates[0].DNSNames)
+	assert.True(t, ca.isValidated())
+	_, err = os.Stat(filepath.Join(cacheDir, domain))
+	assert.NoError(t, err)
+
+	// домены вне списка не обслуживаются
+	_, err = tls.Dial("tcp", ca.addr, &tls.Config{ServerName: "other.example", RootCAs: roots})
+	assert.Error(t, err)
+}
@@ -1,10 +1,11 @@
+// Сертификаты HTTPS сервера: фаилы, самоподписанный сертификат для разработки и ACME.
 package certificate
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
@@ -14,11 +15,17 @@ import (
 	"time"
 )
 
-func Create() error {
+// Create создает самоподписанный сертификат для 127.0.0.1 и ::1 и записывает его и ключ в фаилы.
+// Подходит только для разработки.
+func Create(certFile, keyFile string) error {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return err
+	}
 	// создаём шаблон сертификата
 	cert := &x509.Certificate{
 		// указываем уникальный номер сертификата
-		SerialNumber: big.NewInt(1658),
+		SerialNumber: serial,
 		// заполняем базовую информацию о владельце сертификата
 		Subject: pkix.Name{
 			Organization: []string{"Yandex.Praktikum"},
@@ -36,9 +43,9 @@ func Create() error {
 		KeyUsage:    x509.KeyUsageDigitalSignature,
 	}
 
-	// создаём новый приватный RSA-ключ длиной 4096 бит
+	// создаём новый приватный ECDSA-ключ на кривой P-256
 	// обратите внимание, что для генерации ключа и сертификата используется rand.Reader в качестве источника случайных данных
-	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return err
 	}
@@ -56,26 +63,18 @@ func Create() error {
 		Bytes: certBytes,
 	})
 
-	var privateKeyPEM bytes.Buffer
-	pem.Encode(&privateKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	})
-	err = writeToFile("./server.crt", certPEM.Bytes())
+	keyBytes, err := x509.MarshalECPrivateKey(privateKey)
 	if err != nil {
 		return err
 	}
-	err = writeToFile("./server.key", privateKeyPEM.Bytes())
-	return err
-}
-
-func writeToFile(fname string, data []byte) error {
-	file, err := os.Create(fname)
+	var privateKeyPEM bytes.Buffer
+	pem.Encode(&privateKeyPEM, &pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: keyBytes,
+	})
+	err = os.WriteFile(certFile, certPEM.Bytes(), 0644)
 	if err != nil {
 		return err
 	}
-	writer := bufio.NewWriter(file)
-	writer.Write(data)
-	writer.Flush()
-	return nil
+	return os.WriteFile(keyFile, privateKeyPEM.Bytes(), 0600)
 }
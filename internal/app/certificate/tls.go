@@ -0,0 +1,71 @@
+package certificate
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Options источник сертификата HTTPS сервера.
+type Options struct {
+	// CertFile и KeyFile пути к сертификату и ключу.
+	CertFile string
+	KeyFile  string
+	// SelfSigned создает самоподписанный сертификат в CertFile и KeyFile, если их нет. Только для разработки.
+	SelfSigned bool
+	// ACMEDomains домены, для которых сертификаты выпускаются автоматически. Имеют приоритет над фаилами.
+	ACMEDomains []string
+	// ACMECacheDir каталог для выпущенных сертификатов и ключа аккаунта.
+	ACMECacheDir string
+	// ACMEDirectory адрес каталога ACME, по умолчанию Let's Encrypt.
+	ACMEDirectory string
+	ACMEEmail     string
+}
+
+// TLSConfig собирает настройки TLS. Для сертификата из фаилов возвращается Reloader,
+// сертификаты ACME продлеваются автоматически и Reloader не нужен.
+func TLSConfig(opts Options) (*tls.Config, *Reloader, error) {
+	if len(opts.ACMEDomains) > 0 {
+		return Manager(opts).TLSConfig(), nil, nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, nil, errors.New("tls cert and key files are required")
+	}
+	if opts.SelfSigned && !exists(opts.CertFile) && !exists(opts.KeyFile) {
+		if err := Create(opts.CertFile, opts.KeyFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	reloader, err := NewReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}, reloader, nil
+}
+
+// Manager создает менеджер ACME для доменов из opts. Проверка домена идет через TLS-ALPN-01.
+func Manager(opts Options) *autocert.Manager {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.ACMEDomains...),
+		Email:      opts.ACMEEmail,
+	}
+	if opts.ACMECacheDir != "" {
+		m.Cache = autocert.DirCache(opts.ACMECacheDir)
+	}
+	if opts.ACMEDirectory != "" {
+		m.Client = &acme.Client{DirectoryURL: opts.ACMEDirectory}
+	}
+	return m
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,108 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve принимает соединения и отвечает эхом.
+func serve(t *testing.T, cfg *tls.Config) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func peerCert(t *testing.T, conn *tls.Conn) []byte {
+	require.NoError(t, conn.Handshake())
+	return conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func TestTLSConfig_SelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		SelfSigned: true,
+	}
+	_, _, err := TLSConfig(opts)
+	require.NoError(t, err)
+	first, err := os.ReadFile(opts.CertFile)
+	require.NoError(t, err)
+
+	// существующий сертификат не перезаписывается
+	_, _, err = TLSConfig(opts)
+	require.NoError(t, err)
+	second, err := os.ReadFile(opts.CertFile)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+}
+
+func TestTLSConfig_MissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, _, err := TLSConfig(Options{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+	})
+	assert.Error(t, err)
+	_, _, err = TLSConfig(Options{})
+	assert.Error(t, err)
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	require.NoError(t, Create(certFile, keyFile))
+	cfg, reloader, err := TLSConfig(Options{CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	addr := serve(t, cfg)
+
+	client := &tls.Config{InsecureSkipVerify: true}
+	before, err := tls.Dial("tcp", addr, client)
+	require.NoError(t, err)
+	defer before.Close()
+	oldCert := peerCert(t, before)
+
+	require.NoError(t, Create(certFile, keyFile))
+	require.NoError(t, reloader.Reload())
+
+	after, err := tls.Dial("tcp", addr, client)
+	require.NoError(t, err)
+	defer after.Close()
+	assert.False(t, bytes.Equal(oldCert, peerCert(t, after)))
+
+	// соединение, открытое до перезагрузки, продолжает работать
+	_, err = before.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(before, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	// битый фаил не заменяет рабочий сертификат
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0644))
+	assert.Error(t, reloader.Reload())
+	again, err := tls.Dial("tcp", addr, client)
+	require.NoError(t, err)
+	defer again.Close()
+	assert.NoError(t, again.Handshake())
+}
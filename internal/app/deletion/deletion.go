@@ -0,0 +1,159 @@
+// Очередь асинхронного удаления ссылок. Задачи сохраняются в хранилище до выполнения
+// и продолжаются после перезапуска.
+package deletion
+
+import (
+	"context"
+	"errors"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/worker"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Store хранилище задач удаления.
+type Store interface {
+	CreateDeleteJob(context.Context, model.DeleteJob) error
+	UpdateDeleteJob(context.Context, model.DeleteJob) error
+	// GetDeleteJob возвращает задачу пользователя или model.ErrNotFound.
+	GetDeleteJob(context.Context, model.User, string) (model.DeleteJob, error)
+	PendingDeleteJobs(context.Context) ([]model.DeleteJob, error)
+	// RetryFailedDeleteJobs возвращает в очередь задачи, завершившиеся ошибкой, и сообщает их число.
+	RetryFailedDeleteJobs(context.Context) (int64, error)
+}
+
+// Remover помечает ссылки удаленными и возвращает их число.
+type Remover interface {
+	RemoveItems(context.Context, model.User, []string) (int64, error)
+}
+
+type Queue struct {
+	store   Store
+	remover Remover
+	wp      *worker.WorkerPool
+	now     func() time.Time
+
+	mu       sync.Mutex
+	inflight map[string]bool
+}
+
+func New(store Store, remover Remover, wp *worker.WorkerPool) *Queue {
+	return &Queue{
+		store:    store,
+		remover:  remover,
+		wp:       wp,
+		now:      time.Now,
+		inflight: make(map[string]bool),
+	}
+}
+
+// Submit сохраняет задачу и пробует сразу отдать ее в пул воркеров.
+// Если пул занят, задачу подхватит Run.
+func (q *Queue) Submit(ctx context.Context, user model.User, items []string) (model.DeleteJob, error) {
+	now := q.now().UTC()
+	job := model.DeleteJob{
+		ID:        uuid.New().String(),
+		User:      user,
+		Items:     items,
+		Status:    model.JobQueued,
+		Total:     len(items),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := q.store.CreateDeleteJob(ctx, job); err != nil {
+		return model.DeleteJob{}, err
+	}
+	q.schedule(job)
+	return job, nil
+}
+
+// Status возвращает задачу пользователя.
+func (q *Queue) Status(ctx context.Context, user model.User, id string) (model.DeleteJob, error) {
+	return q.store.GetDeleteJob(ctx, user, id)
+}
+
+// Run отдает в пул незавершенные задачи сразу и затем каждые interval, пока не отменен ctx.
+// Задачи, завершившиеся ошибкой до запуска, выполняются повторно.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	if retried, err := q.store.RetryFailedDeleteJobs(ctx); err != nil {
+		log.Err(err).Msg("Retry failed delete jobs error")
+	} else if retried > 0 {
+		log.Info().Int64("jobs", retried).Msg("Failed delete jobs queued again")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := q.resume(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			log.Err(err).Msg("Resume delete jobs error")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *Queue) resume(ctx context.Context) error {
+	jobs, err := q.store.PendingDeleteJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if !q.schedule(job) {
+			// пул занят, остальные задачи дождутся следующего прохода
+			return nil
+		}
+	}
+	return nil
+}
+
+// schedule ставит задачу в пул без ожидания. Задача, уже стоящая в пуле, повторно не ставится.
+func (q *Queue) schedule(job model.DeleteJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inflight[job.ID] {
+		return true
+	}
+	ok := q.wp.TryPush(func(ctx context.Context) error {
+		defer q.release(job.ID)
+		return q.process(ctx, job)
+	})
+	if ok {
+		q.inflight[job.ID] = true
+	}
+	return ok
+}
+
+func (q *Queue) release(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+}
+
+func (q *Queue) process(ctx context.Context, job model.DeleteJob) error {
+	job.Status = model.JobRunning
+	job.UpdatedAt = q.now().UTC()
+	if err := q.store.UpdateDeleteJob(ctx, job); err != nil {
+		return err
+	}
+	deleted, err := q.remover.RemoveItems(ctx, job.User, job.Items)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// остановка сервера, задача останется незавершенной и выполнится после перезапуска
+		return err
+	}
+	job.Status = model.JobDone
+	job.Deleted = deleted
+	if err != nil {
+		job.Status = model.JobFailed
+		job.Error = err.Error()
+	}
+	job.UpdatedAt = q.now().UTC()
+	if uerr := q.store.UpdateDeleteJob(ctx, job); uerr != nil {
+		return uerr
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package deletion
+
+import (
+	"context"
+	"errors"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/repository"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/worker"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUser = model.User("user")
+
+var testCodes = shortcode.NewAllocator(shortcode.NewHash(8), 3)
+
+// failRemover всегда возвращает ошибку.
+type failRemover struct{}
+
+func (failRemover) RemoveItems(context.Context, model.User, []string) (int64, error) {
+	return 0, errors.New("db is down")
+}
+
+func waitStatus(t *testing.T, q *Queue, id string, status string) model.DeleteJob {
+	var job model.DeleteJob
+	assert.Eventually(t, func() bool {
+		var err error
+		job, err = q.Status(context.Background(), testUser, id)
+		return err == nil && job.Status == status
+	}, time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestQueue_Submit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := repository.New("", testCodes)
+	require.NoError(t, repo.AddItem(testUser, "a", model.Link{URL: "https://a.ru"}, ctx))
+	require.NoError(t, repo.AddItem(testUser, "b", model.Link{URL: "https://b.ru"}, ctx))
+	wp := worker.New(1, 1)
+	go wp.Run(ctx)
+	q := New(repo, repo, wp)
+
+	job, err := q.Submit(ctx, testUser, []string{"a", "b", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, job.Total)
+
+	job = waitStatus(t, q, job.ID, model.JobDone)
+	assert.EqualValues(t, 2, job.Deleted)
+	link, _ := repo.GetItem(testUser, "a", ctx)
+	assert.True(t, link.Deleted)
+
+	_, err = q.Status(ctx, "stranger", job.ID)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestQueue_Failed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := repository.New("", testCodes)
+	wp := worker.New(1, 1)
+	go wp.Run(ctx)
+	q := New(repo, failRemover{}, wp)
+
+	job, err := q.Submit(ctx, testUser, []string{"a"})
+	require.NoError(t, err)
+	job = waitStatus(t, q, job.ID, model.JobFailed)
+	assert.Equal(t, "db is down", job.Error)
+}
+
+func TestQueue_Resume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "storage")
+	repo := repository.New(path, testCodes)
+	require.NoError(t, repo.AddItem(testUser, "a", model.Link{URL: "https://a.ru"}, ctx))
+	require.NoError(t, repo.Flush())
+
+	// пул не запущен и заполнен, задача остается в очереди
+	busy := worker.New(1, 1)
+	require.True(t, busy.TryPush(func(context.Context) error { return nil }))
+	job, err := New(repo, repo, busy).Submit(ctx, testUser, []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, model.JobQueued, job.Status)
+
+	// перезапуск
+	repo = repository.New(path, testCodes)
+	wp := worker.New(1, 1)
+	go wp.Run(ctx)
+	q := New(repo, repo, wp)
+	go q.Run(ctx, time.Hour)
+
+	job = waitStatus(t, q, job.ID, model.JobDone)
+	assert.EqualValues(t, 1, job.Deleted)
+}
+
+func TestQueue_RetryFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "storage")
+	repo := repository.New(path, testCodes)
+	require.NoError(t, repo.AddItem(testUser, "a", model.Link{URL: "https://a.ru"}, ctx))
+	require.NoError(t, repo.Flush())
+	wp := worker.New(1, 1)
+	go wp.Run(ctx)
+	q := New(repo, failRemover{}, wp)
+	job, err := q.Submit(ctx, testUser, []string{"a"})
+	require.NoError(t, err)
+	waitStatus(t, q, job.ID, model.JobFailed)
+
+	// после перезапуска задача выполняется снова
+	repo = repository.New(path, testCodes)
+	q = New(repo, repo, wp)
+	go q.Run(ctx, time.Hour)
+
+	job = waitStatus(t, q, job.ID, model.JobDone)
+	assert.EqualValues(t, 1, job.Deleted)
+	assert.Empty(t, job.Error)
+}
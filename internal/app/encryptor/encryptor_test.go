@@ -4,36 +4,6 @@ import (
 	"testing"
 )
 
-func TestRandomString(t *testing.T) {
-	type args struct {
-		len int
-	}
-	tests := []struct {
-		name string
-		args args
-		want int
-	}{
-		{
-			name: "good payload #1",
-			args: args{10},
-			want: 10,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := len(RandomString(tt.args.len)); got != tt.want {
-				t.Errorf("RandomString() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func BenchmarkRandomString(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		RandomString(10)
-	}
-}
-
 func TestRandomInt(t *testing.T) {
 	type args struct {
 		min int
@@ -0,0 +1,187 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Ошибки проверки токена, все они оборачивают ErrInvalidToken.
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrMalformed    = fmt.Errorf("%w: malformed", ErrInvalidToken)
+	ErrUnknownKey   = fmt.Errorf("%w: unknown key", ErrInvalidToken)
+	ErrTampered     = fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	ErrExpired      = fmt.Errorf("%w: expired", ErrInvalidToken)
+)
+
+// Token расшифрованное содержимое токена.
+type Token struct {
+	UserID    string
+	KeyID     string
+	ExpiresAt time.Time
+}
+
+// Keyring шифрует токены активным ключом и проверяет их любым из известных ключей.
+// Токен имеет вид kid.hex(nonce|ciphertext), идентификатор ключа входит в подпись.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewKeyring создает связку из описания вида "kid:hexkey,kid:hexkey".
+// Первый ключ активный, остальные только проверяют токены на время ротации.
+func NewKeyring(spec string, ttl time.Duration) (*Keyring, error) {
+	kr := &Keyring{
+		keys: make(map[string]cipher.AEAD),
+		ttl:  ttl,
+		now:  time.Now,
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		if err := kr.add(entry); err != nil {
+			return nil, err
+		}
+	}
+	if kr.active == "" {
+		return nil, errors.New("no cookie keys configured")
+	}
+	return kr, nil
+}
+
+// LoadKeyring собирает связку из переменной окружения и файла с ключами по одному на строку.
+// Ключи из окружения идут первыми, пустые строки и строки с # в файле пропускаются.
+func LoadKeyring(spec string, fileName string, ttl time.Duration) (*Keyring, error) {
+	entries := []string{}
+	if spec != "" {
+		entries = append(entries, spec)
+	}
+	if fileName != "" {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return NewKeyring(strings.Join(entries, ","), ttl)
+}
+
+// RandomKeyring создает связку со случайным ключом. Токены не переживают перезапуск.
+func RandomKeyring(ttl time.Duration) (*Keyring, error) {
+	key, err := generateRandom(32)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring("random:"+hex.EncodeToString(key), ttl)
+}
+
+func (kr *Keyring) add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return nil
+	}
+	parts := strings.SplitN(entry, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.Contains(parts[0], ".") {
+		return fmt.Errorf("cookie key %q: want kid:hexkey", entry)
+	}
+	kid := parts[0]
+	if _, ok := kr.keys[kid]; ok {
+		return fmt.Errorf("cookie key %q: duplicate id", kid)
+	}
+	key, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("cookie key %q: %w", kid, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("cookie key %q: %w", kid, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	kr.keys[kid] = aead
+	if kr.active == "" {
+		kr.active = kid
+	}
+	return nil
+}
+
+// Active идентификатор ключа, которым шифруются новые токены.
+func (kr *Keyring) Active() string {
+	return kr.active
+}
+
+// Now текущее время связки.
+func (kr *Keyring) Now() time.Time {
+	return kr.now()
+}
+
+// TTL время жизни новых токенов.
+func (kr *Keyring) TTL() time.Duration {
+	return kr.ttl
+}
+
+// Encode шифрует userID активным ключом со свежим nonce.
+func (kr *Keyring) Encode(userID string) (string, error) {
+	aead := kr.keys[kr.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	plain := make([]byte, 8, 8+len(userID))
+	binary.BigEndian.PutUint64(plain, uint64(kr.now().Add(kr.ttl).Unix()))
+	plain = append(plain, userID...)
+	sealed := aead.Seal(nonce, nonce, plain, []byte(kr.active))
+	return kr.active + "." + hex.EncodeToString(sealed), nil
+}
+
+// Decode проверяет подпись и срок действия токена.
+func (kr *Keyring) Decode(token string) (Token, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return Token{}, ErrMalformed
+	}
+	aead, ok := kr.keys[parts[0]]
+	if !ok {
+		return Token{}, ErrUnknownKey
+	}
+	sealed, err := hex.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return Token{}, ErrMalformed
+	}
+	nonce, ct := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ct, []byte(parts[0]))
+	if err != nil || len(plain) < 8 {
+		return Token{}, ErrTampered
+	}
+	t := Token{
+		UserID:    string(plain[8:]),
+		KeyID:     parts[0],
+		ExpiresAt: time.Unix(int64(binary.BigEndian.Uint64(plain[:8])), 0),
+	}
+	if !kr.now().Before(t.ExpiresAt) {
+		return t, ErrExpired
+	}
+	return t, nil
+}
@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oldKey = "k1:000102030405060708090a0b0c0d0e0f"
+	newKey = "k2:101112131415161718191a1b1c1d1e1f"
+)
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		active  string
+		wantErr bool
+	}{
+		{name: "single key", spec: oldKey, active: "k1"},
+		{name: "first key is active", spec: newKey + "," + oldKey, active: "k2"},
+		{name: "empty", spec: "", wantErr: true},
+		{name: "no id", spec: "000102030405060708090a0b0c0d0e0f", wantErr: true},
+		{name: "bad hex", spec: "k1:zz", wantErr: true},
+		{name: "bad key size", spec: "k1:0001", wantErr: true},
+		{name: "duplicate id", spec: oldKey + "," + oldKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := NewKeyring(tt.spec, time.Hour)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.active, kr.Active())
+		})
+	}
+}
+
+func TestKeyring_Decode(t *testing.T) {
+	old, err := NewKeyring(oldKey, time.Hour)
+	require.NoError(t, err)
+	rotated, err := NewKeyring(newKey+","+oldKey, time.Hour)
+	require.NoError(t, err)
+	other, err := NewKeyring("k1:202122232425262728292a2b2c2d2e2f", time.Hour)
+	require.NoError(t, err)
+
+	issued, err := old.Encode("user")
+	require.NoError(t, err)
+	// меняем последний символ тега подписи
+	tampered := []byte(issued)
+	if tampered[len(tampered)-1] == '0' {
+		tampered[len(tampered)-1] = '1'
+	} else {
+		tampered[len(tampered)-1] = '0'
+	}
+
+	tests := []struct {
+		name    string
+		kr      *Keyring
+		token   string
+		wantErr error
+	}{
+		{name: "same key", kr: old, token: issued},
+		{name: "old key after rotation", kr: rotated, token: issued},
+		{name: "tampered", kr: old, token: string(tampered), wantErr: ErrTampered},
+		{name: "same id other key", kr: other, token: issued, wantErr: ErrTampered},
+		{name: "key id swapped", kr: rotated, token: "k2" + strings.TrimPrefix(issued, "k1"), wantErr: ErrTampered},
+		{name: "unknown key", kr: rotated, token: "k3" + strings.TrimPrefix(issued, "k1"), wantErr: ErrUnknownKey},
+		{name: "no key id", kr: old, token: strings.TrimPrefix(issued, "k1."), wantErr: ErrMalformed},
+		{name: "bad hex", kr: old, token: "k1.zz", wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.kr.Decode(tt.token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user", token.UserID)
+			assert.Equal(t, "k1", token.KeyID)
+		})
+	}
+}
+
+func TestKeyring_FreshNonce(t *testing.T) {
+	kr, err := NewKeyring(oldKey, time.Hour)
+	require.NoError(t, err)
+	a, err := kr.Encode("user")
+	require.NoError(t, err)
+	b, err := kr.Encode("user")
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func TestKeyring_Expired(t *testing.T) {
+	kr, err := NewKeyring(oldKey, time.Hour)
+	require.NoError(t, err)
+	issued, err := kr.Encode("user")
+	require.NoError(t, err)
+	kr.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = kr.Decode(issued)
+	assert.ErrorIs(t, err, ErrExpired)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(fileName, []byte("# retired\n\n"+oldKey+"\n"), 0600))
+	kr, err := LoadKeyring(newKey, fileName, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", kr.Active())
+	assert.Len(t, kr.keys, 2)
+
+	_, err = LoadKeyring("", filepath.Join(t.TempDir(), "missing"), time.Hour)
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	helpers "ilyakasharokov/internal/app/encryptor"
+	"ilyakasharokov/internal/app/middlewares"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authInterceptor определяет пользователя по токену из метаданных user_id, как Cookie в HTTP API.
+// Новый или перевыпущенный токен возвращается в заголовке ответа user_id.
+func authInterceptor(kr *helpers.Keyring) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(middlewares.CookieUserIDName); len(values) > 0 {
+				token = values[0]
+			}
+		}
+		userID, issued, err := middlewares.Identify(kr, token)
+		if errors.Is(err, helpers.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if issued != "" {
+			if err := grpc.SetHeader(ctx, metadata.Pairs(middlewares.CookieUserIDName, issued)); err != nil {
+				return nil, err
+			}
+		}
+		return handler(context.WithValue(ctx, middlewares.UserIDCtxName, userID), req)
+	}
+}
@@ -0,0 +1,236 @@
+// gRPC сервер, повторяющий HTTP API поверх того же репозитория.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	helpers "ilyakasharokov/internal/app/encryptor"
+	"ilyakasharokov/internal/app/handlers"
+	"ilyakasharokov/internal/app/middlewares"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/urlcheck"
+	"ilyakasharokov/pkg/pb"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Server struct {
+	pb.UnimplementedShortenerServer
+	repo    handlers.RepoDBModel
+	codes   *shortcode.Allocator
+	check   *urlcheck.Checker
+	jobs    handlers.DeleteQueue
+	db      *sql.DB
+	baseURL string
+	addr    string
+	srv     *grpc.Server
+}
+
+// New создает сервер. С tlsConfig соединения шифруются, nil оставляет их открытыми.
+func New(repo handlers.RepoDBModel, codes *shortcode.Allocator, check *urlcheck.Checker, jobs handlers.DeleteQueue, keys *helpers.Keyring, address string, baseURL string, database *sql.DB, tlsConfig *tls.Config) *Server {
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(authInterceptor(keys))}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := &Server{
+		repo:    repo,
+		codes:   codes,
+		check:   check,
+		jobs:    jobs,
+		db:      database,
+		baseURL: baseURL,
+		addr:    address,
+		srv:     grpc.NewServer(opts...),
+	}
+	pb.RegisterShortenerServer(s.srv, s)
+	return s
+}
+
+// Start слушает адрес и обслуживает запросы до остановки.
+func (s *Server) Start() error {
+	listen, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	log.Info().Msg("Start grpc server on " + s.addr)
+	return s.Serve(listen)
+}
+
+// Serve обслуживает запросы на переданном listener.
+func (s *Server) Serve(listen net.Listener) error {
+	return s.srv.Serve(listen)
+}
+
+// Cancel дожидается завершения текущих вызовов, но не дольше, чем живет ctx.
+func (s *Server) Cancel(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) short(code string) string {
+	return fmt.Sprintf("%s/%s", s.baseURL, code)
+}
+
+// checkURL проверяет URL, причина отказа передается в тексте статуса.
+func (s *Server) checkURL(ctx context.Context, raw string) (string, error) {
+	url, err := s.check.Check(ctx, raw)
+	if err != nil {
+		var rejected *urlcheck.Error
+		if errors.As(err, &rejected) {
+			return "", status.Errorf(codes.InvalidArgument, "%s: %s", rejected.Reason, rejected.Message)
+		}
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return url, nil
+}
+
+// expiry переводит срок действия из запроса в ссылку.
+func expiry(link *model.Link, expiresAt *timestamppb.Timestamp, ttl int64) error {
+	if expiresAt != nil {
+		t := expiresAt.AsTime()
+		link.ExpiresAt = &t
+	}
+	link.TTL = ttl
+	if err := link.ResolveExpiry(time.Now()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) Shorten(ctx context.Context, in *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	url, err := s.checkURL(ctx, in.Url)
+	if err != nil {
+		return nil, err
+	}
+	if in.Alias != "" && !handlers.ValidAlias(in.Alias) {
+		return nil, status.Error(codes.InvalidArgument, "the alias is incorrect")
+	}
+	link := model.Link{URL: url, RawURL: in.Url, Alias: in.Alias}
+	if err := expiry(&link, in.ExpiresAt, in.TtlSeconds); err != nil {
+		return nil, err
+	}
+	code, existed, err := handlers.SaveLink(ctx, s.repo, s.codes, user(ctx), link)
+	if errors.Is(err, model.ErrCodeTaken) {
+		return nil, status.Error(codes.AlreadyExists, "the alias is taken")
+	}
+	if err != nil {
+		log.Err(err).Msg("Add url error")
+		return nil, status.Error(codes.Internal, "add url error")
+	}
+	return &pb.ShortenResponse{Result: s.short(code), Existed: existed}, nil
+}
+
+func (s *Server) ShortenBatch(ctx context.Context, in *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	links := make([]model.Link, 0, len(in.Items))
+	for _, item := range in.Items {
+		url, err := s.checkURL(ctx, item.OriginalUrl)
+		if err != nil {
+			return nil, err
+		}
+		if item.Alias != "" && !handlers.ValidAlias(item.Alias) {
+			return nil, status.Error(codes.InvalidArgument, "the alias is incorrect: "+item.Alias)
+		}
+		link := model.Link{ID: item.CorrelationId, URL: url, RawURL: item.OriginalUrl, Alias: item.Alias}
+		if err := expiry(&link, item.ExpiresAt, item.TtlSeconds); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	shorts, err := s.repo.BunchSave(ctx, user(ctx), links)
+	if err != nil {
+		log.Err(err).Msg("Can't save links")
+		return nil, status.Error(codes.Internal, "can't save")
+	}
+	out := &pb.ShortenBatchResponse{Results: make([]*pb.BatchResult, 0, len(shorts))}
+	for _, short := range shorts {
+		result := &pb.BatchResult{CorrelationId: short.ID}
+		if short.Short != "" {
+			result.ShortUrl = s.short(short.Short)
+		}
+		if short.Err != nil {
+			result.Error = short.Err.Error()
+		}
+		out.Results = append(out.Results, result)
+	}
+	return out, nil
+}
+
+func (s *Server) Resolve(ctx context.Context, in *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	link, err := s.repo.GetByShort(in.Short, ctx)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("Get link error")
+		return nil, status.Error(codes.Internal, "get link error")
+	}
+	if link.Deleted {
+		return nil, status.Error(codes.NotFound, "deleted")
+	}
+	if link.Expired(time.Now()) {
+		return nil, status.Error(codes.NotFound, "expired")
+	}
+	return &pb.ResolveResponse{OriginalUrl: link.URL}, nil
+}
+
+func (s *Server) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	links, err := s.repo.GetByUser(user(ctx), model.UserLinksQuery{}, ctx)
+	if err != nil {
+		log.Err(err).Msg("Get user links error")
+		return nil, status.Error(codes.Internal, "get links error")
+	}
+	out := &pb.ListUserURLsResponse{Urls: make([]*pb.UserURL, 0, len(links))}
+	for _, link := range links {
+		out.Urls = append(out.Urls, &pb.UserURL{ShortUrl: s.short(link.Short), OriginalUrl: link.URL})
+	}
+	return out, nil
+}
+
+func (s *Server) DeleteUserURLs(ctx context.Context, in *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	if len(in.Items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "no ids")
+	}
+	job, err := s.jobs.Submit(ctx, user(ctx), in.Items)
+	if err != nil {
+		log.Err(err).Msg("Delete job error")
+		return nil, status.Error(codes.Internal, "delete job error")
+	}
+	return &pb.DeleteUserURLsResponse{JobId: job.ID, Status: job.Status}, nil
+}
+
+func (s *Server) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if s.db == nil {
+		return nil, status.Error(codes.Unavailable, "no database")
+	}
+	if err := s.db.PingContext(ctx); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.PingResponse{}, nil
+}
+
+// user пользователь, определенный authInterceptor.
+func user(ctx context.Context) model.User {
+	userID, _ := ctx.Value(middlewares.UserIDCtxName).(string)
+	return model.User(userID)
+}
@@ -0,0 +1,202 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"ilyakasharokov/internal/app/certificate"
+	helpers "ilyakasharokov/internal/app/encryptor"
+	"ilyakasharokov/internal/app/handlers"
+	"ilyakasharokov/internal/app/middlewares"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/repository"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/urlcheck"
+	"ilyakasharokov/pkg/pb"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const baseURL = "http://localhost:8080"
+
+// testQueue запоминает поставленные задачи удаления.
+type testQueue struct {
+	items []string
+}
+
+func (q *testQueue) Submit(_ context.Context, user model.User, items []string) (model.DeleteJob, error) {
+	q.items = items
+	return model.DeleteJob{ID: "job", User: user, Items: items, Status: model.JobQueued}, nil
+}
+
+func (q *testQueue) Status(context.Context, model.User, string) (model.DeleteJob, error) {
+	return model.DeleteJob{}, model.ErrNotFound
+}
+
+func newClient(t *testing.T, jobs handlers.DeleteQueue) (pb.ShortenerClient, *helpers.Keyring) {
+	keys, err := helpers.NewKeyring("k1:000102030405060708090a0b0c0d0e0f", time.Hour)
+	require.NoError(t, err)
+	codes := shortcode.NewAllocator(shortcode.NewHash(8), 3)
+	check, err := urlcheck.New(baseURL, urlcheck.DefaultOptions)
+	require.NoError(t, err)
+	s := New(repository.New("", codes), codes, check, jobs, keys, "", baseURL, nil, nil)
+	listen := bufconn.Listen(1 << 20)
+	go s.Serve(listen)
+	t.Cleanup(s.srv.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listen.Dial() }),
+		grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewShortenerClient(conn), keys
+}
+
+// login выполняет вызов без токена и возвращает контекст с выданным токеном.
+func login(t *testing.T, client pb.ShortenerClient) context.Context {
+	var header metadata.MD
+	_, err := client.ListUserURLs(context.Background(), &pb.ListUserURLsRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	tokens := header.Get(middlewares.CookieUserIDName)
+	require.Len(t, tokens, 1)
+	return metadata.AppendToOutgoingContext(context.Background(), middlewares.CookieUserIDName, tokens[0])
+}
+
+func TestServer_Shorten(t *testing.T) {
+	client, _ := newClient(t, new(testQueue))
+	ctx := login(t, client)
+
+	first, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://yandex.ru"})
+	require.NoError(t, err)
+	assert.False(t, first.Existed)
+	again, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://yandex.ru"})
+	require.NoError(t, err)
+	assert.True(t, again.Existed)
+	assert.Equal(t, first.Result, again.Result)
+
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru", Alias: "api"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru", TtlSeconds: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru", Alias: "sale"})
+	require.NoError(t, err)
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "https://go.dev", Alias: "sale"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	resolved, err := client.Resolve(ctx, &pb.ResolveRequest{Short: "sale"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/", resolved.OriginalUrl)
+	_, err = client.Resolve(ctx, &pb.ResolveRequest{Short: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.Urls, 2)
+}
+
+func TestServer_ShortenBatch(t *testing.T) {
+	client, _ := newClient(t, new(testQueue))
+	ctx := login(t, client)
+
+	out, err := client.ShortenBatch(ctx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://yandex.ru"},
+		{CorrelationId: "2", OriginalUrl: "https://yandex.ru"},
+		{CorrelationId: "3", OriginalUrl: "https://ya.ru", Alias: "sale"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, out.Results, 3)
+	assert.Empty(t, out.Results[0].Error)
+	assert.NotEmpty(t, out.Results[1].Error)
+	assert.Equal(t, out.Results[0].ShortUrl, out.Results[1].ShortUrl)
+	assert.Equal(t, baseURL+"/sale", out.Results[2].ShortUrl)
+}
+
+func TestServer_DeleteUserURLs(t *testing.T) {
+	q := new(testQueue)
+	client, _ := newClient(t, q)
+	ctx := login(t, client)
+
+	_, err := client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	job, err := client.DeleteUserURLs(ctx, &pb.DeleteUserURLsRequest{Items: []string{"sale", "12"}})
+	require.NoError(t, err)
+	assert.Equal(t, "job", job.JobId)
+	assert.Equal(t, model.JobQueued, job.Status)
+	assert.Equal(t, []string{"sale", "12"}, q.items)
+}
+
+func TestServer_Auth(t *testing.T) {
+	client, keys := newClient(t, new(testQueue))
+
+	// свой пользователь у каждого токена
+	ctx := login(t, client)
+	_, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://ya.ru"})
+	require.NoError(t, err)
+	other := login(t, client)
+	list, err := client.ListUserURLs(other, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Urls)
+
+	// токен HTTP API принимается как есть
+	token, err := keys.Encode("user")
+	require.NoError(t, err)
+	var header metadata.MD
+	_, err = client.ListUserURLs(metadata.AppendToOutgoingContext(context.Background(), middlewares.CookieUserIDName, token),
+		&pb.ListUserURLsRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Empty(t, header.Get(middlewares.CookieUserIDName))
+
+	_, err = client.ListUserURLs(metadata.AppendToOutgoingContext(context.Background(), middlewares.CookieUserIDName, "k1.00"),
+		&pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.Ping(ctx, &pb.PingRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	tlsConfig, _, err := certificate.TLSConfig(certificate.Options{
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		SelfSigned: true,
+	})
+	require.NoError(t, err)
+	keys, err := helpers.NewKeyring("k1:000102030405060708090a0b0c0d0e0f", time.Hour)
+	require.NoError(t, err)
+	allocator := shortcode.NewAllocator(shortcode.NewHash(8), 3)
+	check, err := urlcheck.New(baseURL, urlcheck.DefaultOptions)
+	require.NoError(t, err)
+	s := New(repository.New("", allocator), allocator, check, new(testQueue), keys, "", baseURL, nil, tlsConfig)
+	listen := bufconn.Listen(1 << 20)
+	go s.Serve(listen)
+	t.Cleanup(s.srv.Stop)
+	dial := func(creds grpc.DialOption) pb.ShortenerClient {
+		conn, err := grpc.Dial("bufnet",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listen.Dial() }),
+			creds)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return pb.NewShortenerClient(conn)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// самоподписанный сертификат клиент не проверяет
+	secure := dial(grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
+	_, err = secure.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	assert.NoError(t, err)
+
+	plain := dial(grpc.WithInsecure())
+	_, err = plain.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -7,58 +7,147 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"ilyakasharokov/internal/app/base62"
+	"ilyakasharokov/internal/app/httperror"
 	"ilyakasharokov/internal/app/middlewares"
 	"ilyakasharokov/internal/app/model"
-	"ilyakasharokov/internal/app/worker"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/urlcheck"
 	"io"
 	"io/ioutil"
 	"net/http"
-	urltool "net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 )
 
+// CodePattern шаблон короткого кода в маршруте редиректа.
+const CodePattern = `[0-9a-zA-Z-]+`
+
+// maxAliasLength максимальная длина пользовательского псевдонима.
+const maxAliasLength = 64
+
+// Размер страницы списка ссылок пользователя.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+var (
+	aliasRe = regexp.MustCompile(`^` + CodePattern + `$`)
+	// reservedAliases первые сегменты путей сервиса, недоступные для редиректа.
+	reservedAliases = map[string]bool{"api": true, "user": true, "ping": true, "debug": true, "metrics": true}
+)
+
 type URL struct {
 	URL string `json:"url"`
+	// Alias необязательный пользовательский короткий код.
+	Alias string `json:"alias,omitempty"`
+	// ExpiresAt и TTL необязательный срок действия ссылки, задается одно из двух.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl_seconds,omitempty"`
+}
+
+// BatchResult результат сохранения одного URL из пакета.
+type BatchResult struct {
+	ID    string `json:"correlation_id"`
+	Short string `json:"short_url,omitempty"`
+	// Status 201 для нового URL и 409, если URL был сохранен ранее или псевдоним занят.
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
 }
 
-type RepoModel interface {
-	AddItem(model.User, string, model.Link) error
-	GetItem(model.User, string) (model.Link, error)
-	CheckExist(model.User, string) bool
-	GetByUser(model.User) (model.Links, error)
+// ValidAlias проверяет псевдоним по шаблону маршрута редиректа.
+func ValidAlias(alias string) bool {
+	return len(alias) <= maxAliasLength && aliasRe.MatchString(alias) && !reservedAliases[strings.ToLower(alias)]
 }
 
 type RepoDBModel interface {
 	AddItem(model.User, string, model.Link, context.Context) error
 	GetItem(model.User, string, context.Context) (model.Link, error)
-	CheckExist(model.User, string) bool
-	GetByUser(model.User, context.Context) (model.Links, error)
+	GetByShort(string, context.Context) (model.Link, error)
+	GetByOrigin(model.User, string, context.Context) (string, error)
+	CheckExist(string) bool
+	GetByUser(model.User, model.UserLinksQuery, context.Context) ([]model.Link, error)
 	BunchSave(context.Context, model.User, []model.Link) ([]model.ShortLink, error)
-	RemoveItems(model.User, []int) error
+	RemoveItems(context.Context, model.User, []string) (int64, error)
+	RemoveExpired(context.Context) (int64, error)
+	ServiceStats(context.Context) (model.ServiceStats, error)
+}
+
+// DeleteQueue очередь асинхронного удаления ссылок.
+type DeleteQueue interface {
+	Submit(context.Context, model.User, []string) (model.DeleteJob, error)
+	Status(context.Context, model.User, string) (model.DeleteJob, error)
+}
+
+// ClickRecorder записывает переходы по коротким ссылкам.
+type ClickRecorder interface {
+	Record(*http.Request, string)
+}
+
+// ClickStatsModel источник статистики переходов.
+type ClickStatsModel interface {
+	ClickStats(context.Context, string) (model.ClickStats, error)
+}
+
+// SaveLink сохраняет ссылку пользователя под псевдонимом или сгенерированным кодом и возвращает код.
+// Если пользователь уже сокращал этот URL, conflict равен true и возвращается сохраненный ранее код.
+// Занятый псевдоним возвращает ошибку model.ErrCodeTaken.
+func SaveLink(ctx context.Context, repo RepoDBModel, codes *shortcode.Allocator, user model.User, link model.Link) (code string, conflict bool, err error) {
+	code, err = repo.GetByOrigin(user, link.URL, ctx)
+	if err == nil {
+		return code, true, nil
+	}
+	if !errors.Is(err, model.ErrNotFound) {
+		return "", false, err
+	}
+	code = link.Alias
+	if code == "" {
+		code, err = codes.Allocate(link.URL, repo.CheckExist)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	err = repo.AddItem(user, code, link, ctx)
+	if errors.Is(err, model.ErrOriginExists) {
+		// URL сохранен параллельным запросом
+		code, err = repo.GetByOrigin(user, link.URL, ctx)
+		return code, err == nil, err
+	}
+	return code, false, err
+}
+
+// urlError переводит отказ проверки URL в ошибку 400 с кодом причины.
+func urlError(err error) error {
+	var rejected *urlcheck.Error
+	if errors.As(err, &rejected) {
+		return httperror.BadRequest(rejected.Reason, rejected.Message)
+	}
+	return err
 }
 
-// CreateShort cоздает URL из тела запроса. В качестве параметра принимает репозиторий и адрес для шорта.
-func CreateShort(repo RepoDBModel, baseURL string) func(w http.ResponseWriter, r *http.Request) {
+// CreateShort cоздает URL из тела запроса. В качестве параметра принимает репозиторий, генератор кодов, проверку URL и адрес для шорта.
+func CreateShort(repo RepoDBModel, codes *shortcode.Allocator, check *urlcheck.Checker, baseURL string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Body read error", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeBadRequest, "Body read error"))
 			return
 		}
 		url := string(body)
 		if url == "" {
-			http.Error(w, "Body is empty", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeBadRequest, "Body is empty"))
 			return
 		}
 
-		_, err = urltool.ParseRequestURI(url)
-
+		canonical, err := check.Check(r.Context(), url)
 		if err != nil {
-			http.Error(w, "The url is incorrect", http.StatusBadRequest)
+			httperror.Write(w, r, urlError(err))
 			return
 		}
 
@@ -70,65 +159,53 @@ func CreateShort(repo RepoDBModel, baseURL string) func(w http.ResponseWriter, r
 		}
 
 		link := model.Link{
-			URL: url,
-		}
-
-		var code string
-		for {
-			code, err = base62.Decode(link.URL)
-			if err != nil {
-				http.Error(w, "URL decode error", http.StatusInternalServerError)
-				return
-			}
-			if !repo.CheckExist(model.User(userID), code) {
-				break
-			}
-		}
-		link, err = repo.GetItem(model.User(userID), code, r.Context())
-		result := fmt.Sprintf("%s/%s", baseURL, code)
-		if err == nil {
-			http.Error(w, "Already exist", http.StatusConflict)
-			w.Header().Add("Content-type", "text/plain; charset=utf-8")
-			w.Write([]byte(result))
-			return
+			URL:    canonical,
+			RawURL: url,
 		}
 
-		err = repo.AddItem(model.User(userID), code, link, r.Context())
+		code, conflict, err := SaveLink(r.Context(), repo, codes, model.User(userID), link)
 		if err != nil {
-			http.Error(w, "Add url error", http.StatusInternalServerError)
+			httperror.Write(w, r, httperror.Internal(err))
 			return
+		}
+		result := fmt.Sprintf("%s/%s", baseURL, code)
+		w.Header().Add("Content-type", "text/plain; charset=utf-8")
+		if conflict {
+			w.WriteHeader(http.StatusConflict)
 		} else {
 			w.WriteHeader(http.StatusCreated)
 		}
-		w.Header().Add("Content-type", "text/plain; charset=utf-8")
 		w.Write([]byte(result))
 	}
 }
 
-// APICreateShort запрашивает создание URL из json. В качестве параметра принимает репозиторий и адрес для шорта.
-func APICreateShort(repo RepoDBModel, baseURL string) func(w http.ResponseWriter, r *http.Request) {
+// APICreateShort запрашивает создание URL из json. В качестве параметра принимает репозиторий, генератор кодов, проверку URL и адрес для шорта.
+func APICreateShort(repo RepoDBModel, codes *shortcode.Allocator, check *urlcheck.Checker, baseURL string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "body read error", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeBadRequest, "body read error"))
 			return
 		}
 		url := URL{}
 		err = json.Unmarshal(body, &url)
 		if err != nil {
-			http.Error(w, "JSON is incorrect", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeInvalidJSON, "JSON is incorrect"))
 			return
 		}
 		if url.URL == "" {
-			http.Error(w, "URL is empty", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeBadRequest, "URL is empty"))
 			return
 		}
 
-		_, err = urltool.ParseRequestURI(url.URL)
-
+		canonical, err := check.Check(r.Context(), url.URL)
 		if err != nil {
-			http.Error(w, "the url is incorrect", http.StatusBadRequest)
+			httperror.Write(w, r, urlError(err))
+			return
+		}
+		if url.Alias != "" && !ValidAlias(url.Alias) {
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeInvalidAlias, "the alias is incorrect"))
 			return
 		}
 
@@ -140,67 +217,84 @@ func APICreateShort(repo RepoDBModel, baseURL string) func(w http.ResponseWriter
 		}
 
 		link := model.Link{
-			URL: url.URL,
+			URL:       canonical,
+			RawURL:    url.URL,
+			Alias:     url.Alias,
+			ExpiresAt: url.ExpiresAt,
+			TTL:       url.TTL,
+		}
+		if err = link.ResolveExpiry(time.Now()); err != nil {
+			httperror.Write(w, r, err)
+			return
 		}
 
-		var code string
-		for {
-			code, err = base62.Decode(link.URL)
-			if err != nil {
-				http.Error(w, "URL decode error", http.StatusInternalServerError)
-				return
-			}
-			if !repo.CheckExist(model.User(userID), code) {
-				break
-			}
+		code, conflict, err := SaveLink(r.Context(), repo, codes, model.User(userID), link)
+		if errors.Is(err, model.ErrCodeTaken) {
+			httperror.Write(w, r, httperror.New(http.StatusConflict, httperror.CodeConflict, "the alias is taken"))
+			return
+		}
+		if err != nil {
+			httperror.Write(w, r, httperror.Internal(err))
+			return
 		}
 
-		_, err = repo.GetItem(model.User(userID), code, r.Context())
 		newlink := fmt.Sprintf("%s/%s", baseURL, code)
 		result := struct {
 			Result string `json:"result"`
 		}{Result: newlink}
-		if err == nil {
-			w.Header().Add("Content-Type", "application/json; charset=utf-8")
-			w.WriteHeader(http.StatusConflict)
-			body, err = json.Marshal(result)
-			if err != nil {
-				http.Error(w, "response JSON error", http.StatusInternalServerError)
-				return
-			}
-			w.Write(body)
+		body, err = json.Marshal(result)
+		if err != nil {
+			httperror.Write(w, r, httperror.Internal(err))
 			return
 		}
 
-		err = repo.AddItem(model.User(userID), code, link, r.Context())
-		if err != nil {
-			http.Error(w, "Add url error", http.StatusInternalServerError)
-			return
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		if conflict {
+			w.WriteHeader(http.StatusConflict)
 		} else {
 			w.WriteHeader(http.StatusCreated)
 		}
-
-		body, err = json.Marshal(result)
-		if err != nil {
-			http.Error(w, "response JSON error", http.StatusInternalServerError)
-			return
-		}
-
 		w.Write(body)
 	}
 }
 
-// GetShort получает пользовательский URL по коду. В качестве параметра принимает репозиторий.
-func GetShort(repo RepoDBModel) http.HandlerFunc {
+// GetShort получает URL по коду независимо от пользователя и записывает переход.
+// В качестве параметра принимает репозиторий и сборщик переходов.
+func GetShort(repo RepoDBModel, clicks ClickRecorder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		pathSplit := strings.Split(r.URL.Path, "/")
 
 		if len(pathSplit) != 2 {
-			http.Error(w, "no id", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeBadRequest, "no id"))
 			return
 		}
 		id := pathSplit[1]
 
+		entity, err := repo.GetByShort(id, r.Context())
+
+		if err != nil {
+			httperror.Write(w, r, err)
+			return
+		}
+		if entity.Deleted {
+			httperror.Write(w, r, model.ErrDeleted)
+			return
+		}
+		if entity.Expired(time.Now()) {
+			httperror.Write(w, r, model.ErrExpired)
+			return
+		}
+		clicks.Record(r, id)
+		http.Redirect(w, r, entity.URL, http.StatusTemporaryRedirect)
+	}
+}
+
+// Stats возвращает статистику переходов по ссылке пользователя.
+// В качестве параметра принимает репозиторий и источник статистики.
+func Stats(repo RepoDBModel, stats ClickStatsModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		short := chi.URLParam(r, "short")
+
 		userIDCtx := r.Context().Value(middlewares.UserIDCtxName)
 		userID := "default"
 		if userIDCtx != nil {
@@ -208,22 +302,50 @@ func GetShort(repo RepoDBModel) http.HandlerFunc {
 			userID = userIDCtx.(string)
 		}
 
-		entity, err := repo.GetItem(model.User(userID), id, r.Context())
+		_, err := repo.GetItem(model.User(userID), short, r.Context())
+		if err != nil {
+			httperror.Write(w, r, err)
+			return
+		}
 
+		result, err := stats.ClickStats(r.Context(), short)
 		if err != nil {
-			log.Err(err).Msg("Not found")
-			http.Error(w, "Not found", http.StatusNotFound)
+			httperror.Write(w, r, httperror.Internal(err))
 			return
 		}
-		if entity.Deleted {
-			log.Info().Str("id", entity.ID).Msg("Link is deleted")
-			http.Error(w, "Deleted", http.StatusGone)
+		body, err := json.Marshal(result)
+		if err != nil {
+			httperror.Write(w, r, httperror.Internal(err))
+			return
 		}
-		http.Redirect(w, r, entity.URL, http.StatusTemporaryRedirect)
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}
+}
+
+// InternalStats возвращает число сокращенных URL и пользователей. В качестве параметра принимает репозиторий.
+func InternalStats(repo RepoDBModel) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := repo.ServiceStats(r.Context())
+		if err != nil {
+			httperror.Write(w, r, httperror.Internal(err))
+			return
+		}
+		body, err := json.Marshal(stats)
+		if err != nil {
+			httperror.Write(w, r, httperror.Internal(err))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
 	}
 }
 
-// GetUserShorts получение списка пользовательских URL. В качестве параметра принимает репозиторий.
+// GetUserShorts получение страницы пользовательских URL, 204 если их нет. В качестве параметра принимает репозиторий.
+// Параметры запроса: limit, cursor, order (desc по умолчанию или asc), q подстрока оригинального URL
+// и include_deleted. Курсор следующей страницы отдается в заголовке X-Next-Cursor.
 func GetUserShorts(repo RepoDBModel) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -234,17 +356,44 @@ func GetUserShorts(repo RepoDBModel) http.HandlerFunc {
 			userID = userIDCtx.(string)
 		}
 
-		links, err := repo.GetByUser(model.User(userID), r.Context())
+		q, err := userLinksQuery(r)
+		if err != nil {
+			httperror.Write(w, r, err)
+			return
+		}
+		limit := q.Limit
+		// лишняя ссылка показывает, есть ли следующая страница
+		q.Limit++
+		links, err := repo.GetByUser(model.User(userID), q, r.Context())
 		if err != nil {
-			log.Err(err).Str("user", userID).Msg("No links")
-			http.Error(w, "no content", http.StatusNoContent)
+			httperror.Write(w, r, httperror.Internal(err))
+			return
+		}
+		if len(links) > limit {
+			links = links[:limit]
+			w.Header().Set("X-Next-Cursor", model.CursorOf(links[limit-1]).String())
+		}
+		if len(links) == 0 {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		body, err := links.MarshalJSON()
+		result := make([]model.UserLink, len(links))
+		for i, link := range links {
+			result[i] = model.UserLink{
+				ShortURL:    link.Short,
+				OriginalURL: link.URL,
+				RawURL:      link.RawURL,
+				Deleted:     link.Deleted,
+			}
+			if !link.CreatedAt.IsZero() {
+				createdAt := link.CreatedAt
+				result[i].CreatedAt = &createdAt
+			}
+		}
+		body, err := json.Marshal(result)
 		if err != nil {
-			log.Err(err).Msg("Marshal links error")
-			http.Error(w, "json error", http.StatusInternalServerError)
+			httperror.Write(w, r, httperror.Internal(err))
 			return
 		}
 
@@ -254,27 +403,60 @@ func GetUserShorts(repo RepoDBModel) http.HandlerFunc {
 	}
 }
 
-func bodyFromJSON(w *http.ResponseWriter, r *http.Request) ([]byte, error) {
-	var body []byte
+// userLinksQuery разбирает параметры выборки ссылок пользователя.
+func userLinksQuery(r *http.Request) (model.UserLinksQuery, error) {
+	values := r.URL.Query()
+	q := model.UserLinksQuery{Limit: defaultPageLimit, Desc: true, Contains: values.Get("q")}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return q, httperror.BadRequest(httperror.CodeBadRequest, "limit must be from 1 to "+strconv.Itoa(maxPageLimit))
+		}
+		q.Limit = n
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		after, err := model.ParseCursor(cursor)
+		if err != nil {
+			return q, httperror.BadRequest(httperror.CodeInvalidCursor, err.Error())
+		}
+		q.After = after
+	}
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Desc = false
+	default:
+		return q, httperror.BadRequest(httperror.CodeBadRequest, "order must be asc or desc")
+	}
+	if deleted := values.Get("include_deleted"); deleted != "" {
+		include, err := strconv.ParseBool(deleted)
+		if err != nil {
+			return q, httperror.BadRequest(httperror.CodeBadRequest, "include_deleted must be a boolean")
+		}
+		q.IncludeDeleted = include
+	}
+	return q, nil
+}
+
+// bodyFromJSON читает непустое тело запроса.
+func bodyFromJSON(r *http.Request) ([]byte, error) {
 	if r.Body == http.NoBody {
-		http.Error(*w, "no content", http.StatusBadRequest)
-		return body, errors.New("bad request")
+		return nil, httperror.BadRequest(httperror.CodeBadRequest, "no content")
 	}
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		http.Error(*w, "unknown url", http.StatusBadRequest)
-		return body, errors.New("unknown url")
+		return nil, httperror.BadRequest(httperror.CodeBadRequest, "body read error")
 	}
 	return body, nil
 }
 
-// BunchSaveJSON загружает набор урлов в репозиторий. В качестве параметра принимает репозиторий и адрес для шорта.
-func BunchSaveJSON(repo RepoDBModel, baseURL string) http.HandlerFunc {
+// BunchSaveJSON загружает набор урлов в репозиторий. В качестве параметра принимает репозиторий, проверку URL и адрес для шорта.
+// Если хотя бы один URL не прошел проверку, пакет не сохраняется.
+func BunchSaveJSON(repo RepoDBModel, check *urlcheck.Checker, baseURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		body, err := bodyFromJSON(&w, r)
+		body, err := bodyFromJSON(r)
 		if err != nil {
-			log.Err(err).Msg("Can't read body")
-			http.Error(w, "Can't read body", http.StatusBadRequest)
+			httperror.Write(w, r, err)
 			return
 		}
 		userIDCtx := r.Context().Value(middlewares.UserIDCtxName)
@@ -287,45 +469,74 @@ func BunchSaveJSON(repo RepoDBModel, baseURL string) http.HandlerFunc {
 		var urls []model.Link
 		err = json.Unmarshal(body, &urls)
 		if err != nil {
-			log.Err(err).Msg("Unmarshal json error")
-			http.Error(w, "bad json", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeInvalidJSON, "bad json"))
 			return
 		}
+		now := time.Now()
+		for k := range urls {
+			if err = prepareLink(r.Context(), check, &urls[k], now); err != nil {
+				if e := httperror.From(err); e.Status == http.StatusBadRequest {
+					err = httperror.BadRequest(e.Code, e.Message+": "+urls[k].ID)
+				}
+				httperror.Write(w, r, err)
+				return
+			}
+		}
 		shorts, err := repo.BunchSave(r.Context(), model.User(userID), urls)
 		if err != nil {
-			log.Err(err).Msg("Can't save links")
-			http.Error(w, "can't save", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.Internal(err))
 			return
 		}
 		// Prepare results
-		for k := range shorts {
-			shorts[k].Short = fmt.Sprintf("%s/%s", baseURL, shorts[k].Short)
+		results := make([]BatchResult, 0, len(shorts))
+		conflicts := 0
+		for _, short := range shorts {
+			result := BatchResult{
+				ID:     short.ID,
+				Status: http.StatusCreated,
+			}
+			if short.Short != "" {
+				result.Short = fmt.Sprintf("%s/%s", baseURL, short.Short)
+			}
+			if short.Err != nil {
+				result.Status = http.StatusConflict
+				result.Error = short.Err.Error()
+				conflicts++
+			}
+			results = append(results, result)
+		}
+		// 409, только если ни один URL не был сохранен
+		status := http.StatusCreated
+		if conflicts > 0 && conflicts == len(shorts) {
+			status = http.StatusConflict
 		}
 
-		body, err = json.Marshal(shorts)
+		body, err = json.Marshal(results)
 		if err != nil {
-			log.Err(err).Msg("Marshal links error")
-			http.Error(w, "Marshal error", http.StatusBadRequest)
+			httperror.Write(w, r, httperror.Internal(err))
+			return
 		}
 
 		// Prepare response
 		w.Header().Add("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(status)
 		_, err = w.Write(body)
 		if err != nil {
 			log.Err(err).Msg("Body write error")
-			http.Error(w, "Body write error", http.StatusBadRequest)
 		}
-
 	}
 }
 
-// Ping пингует базу данных. В качестве параметра принимает базу данных.
+// Ping пингует базу данных. В качестве параметра принимает базу данных, nil при хранении в памяти.
 func Ping(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		err := db.PingContext(r.Context())
 		if err != nil {
-			fmt.Println(err)
+			log.Err(err).Msg("Ping error")
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -334,26 +545,60 @@ func Ping(db *sql.DB) http.HandlerFunc {
 }
 
 // Delete принимает множество URL в очередь на удаление.
-func Delete(repo RepoDBModel, workerPool *worker.WorkerPool) func(w http.ResponseWriter, r *http.Request) {
+func Delete(jobs DeleteQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
-		body, err := io.ReadAll(r.Body)
+		items, err := deleteItems(r.Body)
 		if err != nil {
-			fmt.Println(err)
-			http.Error(w, "body read error", http.StatusBadRequest)
+			log.Err(err).Msg("Delete request error")
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeInvalidJSON, "JSON is incorrect"))
 			return
 		}
-		var ids []int
-		err = json.Unmarshal(body, &ids)
-		if err != nil {
-			fmt.Println(err)
-			http.Error(w, "JSON is incorrect", http.StatusBadRequest)
+		if len(items) == 0 {
+			httperror.Write(w, r, httperror.BadRequest(httperror.CodeBadRequest, "No ids"))
 			return
 		}
-		if len(ids) == 0 {
-			http.Error(w, "No ids", http.StatusBadRequest)
+		userIDCtx := r.Context().Value(middlewares.UserIDCtxName)
+		userID := "default"
+		if userIDCtx != nil {
+			// Convert interface type to user.UniqUser
+			userID = userIDCtx.(string)
+		}
+
+		job, err := jobs.Submit(r.Context(), model.User(userID), items)
+		if err != nil {
+			httperror.Write(w, r, httperror.Internal(err))
 			return
 		}
+		writeJob(w, r, http.StatusAccepted, job)
+	}
+}
+
+// deleteItems читает JSON массив коротких кодов и числовых id.
+func deleteItems(body io.Reader) ([]string, error) {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	var raw []interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	items := make([]string, 0, len(raw))
+	for _, v := range raw {
+		switch item := v.(type) {
+		case string:
+			items = append(items, item)
+		case json.Number:
+			items = append(items, item.String())
+		default:
+			return nil, fmt.Errorf("unexpected item %v", v)
+		}
+	}
+	return items, nil
+}
+
+// DeleteStatus состояние задачи удаления пользователя.
+func DeleteStatus(jobs DeleteQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		userIDCtx := r.Context().Value(middlewares.UserIDCtxName)
 		userID := "default"
 		if userIDCtx != nil {
@@ -361,13 +606,22 @@ func Delete(repo RepoDBModel, workerPool *worker.WorkerPool) func(w http.Respons
 			userID = userIDCtx.(string)
 		}
 
-		bf := func(_ context.Context) error {
-			repo.RemoveItems(model.User(userID), ids)
-			return nil
+		job, err := jobs.Status(r.Context(), model.User(userID), chi.URLParam(r, "job"))
+		if err != nil {
+			httperror.Write(w, r, err)
+			return
 		}
+		writeJob(w, r, http.StatusOK, job)
+	}
+}
 
-		workerPool.Push(bf)
-		w.WriteHeader(http.StatusAccepted)
-
+func writeJob(w http.ResponseWriter, r *http.Request, status int, job model.DeleteJob) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		httperror.Write(w, r, httperror.Internal(err))
+		return
 	}
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
 }
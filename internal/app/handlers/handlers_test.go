@@ -2,30 +2,60 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"ilyakasharokov/cmd/shortener/configuration"
+	"ilyakasharokov/internal/app/httperror"
+	"ilyakasharokov/internal/app/middlewares"
 	"ilyakasharokov/internal/app/mocks"
 	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/repository"
+	"ilyakasharokov/internal/app/shortcode"
+	"ilyakasharokov/internal/app/urlcheck"
+	"io"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-const testURL = "https://yandex.ru"
+const testURL = "https://yandex.ru/"
 const testUser = model.User("default")
 const testCode = "1692759882237307797"
 
+// testGenerator всегда выдает testCode.
+type testGenerator struct{}
+
+func (testGenerator) Generate(string, int) string {
+	return testCode
+}
+
+var testCodes = shortcode.NewAllocator(testGenerator{}, 1)
+
+// testRecorder запоминает записанные переходы.
+type testRecorder struct {
+	shorts []string
+}
+
+func (rec *testRecorder) Record(_ *http.Request, short string) {
+	rec.shorts = append(rec.shorts, short)
+}
+
 var cfg = configuration.Config{
 	BaseURL:         "http://example.com",
 	FileStoragePath: "",
 }
 
+var testCheck, _ = urlcheck.New(cfg.BaseURL, urlcheck.DefaultOptions)
+
 func TestCreateShort(t *testing.T) {
 	type want struct {
 		code        int
@@ -41,7 +71,7 @@ func TestCreateShort(t *testing.T) {
 			payload: testURL,
 			want: want{
 				code:        http.StatusCreated,
-				contentType: "",
+				contentType: "text/plain; charset=utf-8",
 			},
 		},
 		{
@@ -65,13 +95,12 @@ func TestCreateShort(t *testing.T) {
 	repo := new(mocks.RepoDBModel)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo.On("CheckExist", model.User(testUser), testCode).Return(false)
+			repo.On("CheckExist", testCode).Return(false)
 			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.payload))
-			repo.On("GetItem", model.User(testUser), testCode, request.Context()).Return(model.Link{}, errors.New("not found"))
-			repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: ""}, request.Context()).Return(nil)
-			repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: tt.payload}, request.Context()).Return(nil)
+			repo.On("GetByOrigin", model.User(testUser), tt.payload, request.Context()).Return("", model.ErrNotFound)
+			repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: tt.payload, RawURL: tt.payload}, request.Context()).Return(nil)
 			w := httptest.NewRecorder()
-			h := http.HandlerFunc(CreateShort(repo, cfg.BaseURL))
+			h := http.HandlerFunc(CreateShort(repo, testCodes, testCheck, cfg.BaseURL))
 			h.ServeHTTP(w, request)
 			res := w.Result()
 			defer res.Body.Close()
@@ -84,10 +113,87 @@ func TestCreateShort(t *testing.T) {
 	}
 }
 
+func TestCreateShortRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+		payload string
+		reason  string
+	}{
+		{name: "javascript", handler: CreateShort(nil, testCodes, testCheck, cfg.BaseURL), path: "/", payload: "javascript:alert(1)", reason: urlcheck.ReasonScheme},
+		{name: "file", handler: CreateShort(nil, testCodes, testCheck, cfg.BaseURL), path: "/", payload: "file:///etc/passwd", reason: urlcheck.ReasonScheme},
+		{name: "loopback", handler: APICreateShort(nil, testCodes, testCheck, cfg.BaseURL), path: "/api/shorten", payload: `{"url":"http://127.0.0.1/admin"}`, reason: urlcheck.ReasonPrivate},
+		{name: "self", handler: APICreateShort(nil, testCodes, testCheck, cfg.BaseURL), path: "/api/shorten", payload: `{"url":"http://example.com/abc"}`, reason: urlcheck.ReasonSelf},
+		{name: "batch", handler: BunchSaveJSON(nil, testCheck, cfg.BaseURL), path: "/api/shorten/batch", payload: `[{"correlation_id":"1","original_url":"https://ya.ru"},{"correlation_id":"2","original_url":"http://localhost"}]`, reason: urlcheck.ReasonPrivate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.payload)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			if tt.path == "/" {
+				assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+				assert.NotEmpty(t, w.Body.String())
+				return
+			}
+			assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+			var envelope struct {
+				Error httperror.Error `json:"error"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+			assert.Equal(t, tt.reason, envelope.Error.Code)
+			assert.NotEmpty(t, envelope.Error.Message)
+		})
+	}
+}
+
+func TestCreateShortExisting(t *testing.T) {
+	repo := new(mocks.RepoDBModel)
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testURL))
+	repo.On("GetByOrigin", model.User(testUser), testURL, request.Context()).Return("stored", nil)
+	w := httptest.NewRecorder()
+	h := http.HandlerFunc(CreateShort(repo, testCodes, testCheck, cfg.BaseURL))
+	h.ServeHTTP(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	assert.EqualValues(t, http.StatusConflict, res.StatusCode)
+	assert.Equal(t, cfg.BaseURL+"/stored", string(body))
+	repo.AssertNotCalled(t, "AddItem", model.User(testUser), testCode, model.Link{URL: testURL, RawURL: testURL}, request.Context())
+}
+
+func TestCreateShortCanonical(t *testing.T) {
+	repo := new(mocks.RepoDBModel)
+	raw := "HTTPS://Yandex.RU:443?b=1&a=2"
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(raw))
+	// дубль ищется по каноническому виду, исходный адрес сохраняется рядом
+	repo.On("GetByOrigin", model.User(testUser), testURL+"?a=2&b=1", request.Context()).Return("", model.ErrNotFound)
+	repo.On("CheckExist", testCode).Return(false)
+	repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: testURL + "?a=2&b=1", RawURL: raw}, request.Context()).Return(nil)
+	w := httptest.NewRecorder()
+	CreateShort(repo, testCodes, testCheck, cfg.BaseURL)(w, request)
+	assert.EqualValues(t, http.StatusCreated, w.Code)
+	repo.AssertExpectations(t)
+}
+
+func TestCreateShortCollision(t *testing.T) {
+	repo := new(mocks.RepoDBModel)
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testURL))
+	repo.On("GetByOrigin", model.User(testUser), testURL, request.Context()).Return("", model.ErrNotFound)
+	repo.On("CheckExist", mock.Anything).Return(true)
+	w := httptest.NewRecorder()
+	h := http.HandlerFunc(CreateShort(repo, testCodes, testCheck, cfg.BaseURL))
+	h.ServeHTTP(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+	assert.EqualValues(t, http.StatusInternalServerError, res.StatusCode)
+}
+
 func ExampleCreateShort() {
 	repo := new(mocks.RepoDBModel)
 	r := chi.NewRouter()
-	r.Post("/", CreateShort(repo, "http://example.com"))
+	r.Post("/", CreateShort(repo, testCodes, testCheck, "http://example.com"))
 }
 
 func TestGetShort(t *testing.T) {
@@ -116,17 +222,43 @@ func TestGetShort(t *testing.T) {
 				contentType: "application/text",
 			},
 		},
+		{
+			name: "#3 get deleted link",
+			path: "deleted",
+			want: want{
+				code: http.StatusGone,
+			},
+		},
+		{
+			name: "#4 get expired link",
+			path: "expired",
+			want: want{
+				code: http.StatusGone,
+			},
+		},
+		{
+			name: "#5 storage error",
+			path: "broken",
+			want: want{
+				code: http.StatusInternalServerError,
+			},
+		},
 	}
+	expired := time.Now().Add(-time.Minute)
 
 	repo := new(mocks.RepoDBModel)
+	clicks := new(testRecorder)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%s", tt.path), nil)
-			repo.On("GetItem", model.User(testUser), "_", request.Context()).Return(model.Link{}, errors.New("Not found"))
-			repo.On("GetItem", model.User(testUser), testCode, request.Context()).Return(model.Link{URL: testURL}, nil)
+			repo.On("GetByShort", "_", request.Context()).Return(model.Link{}, model.ErrNotFound)
+			repo.On("GetByShort", "broken", request.Context()).Return(model.Link{}, errors.New("connection refused"))
+			repo.On("GetByShort", testCode, request.Context()).Return(model.Link{URL: testURL}, nil)
+			repo.On("GetByShort", "deleted", request.Context()).Return(model.Link{URL: testURL, Deleted: true}, nil)
+			repo.On("GetByShort", "expired", request.Context()).Return(model.Link{URL: testURL, ExpiresAt: &expired}, nil)
 			w := httptest.NewRecorder()
-			h := http.HandlerFunc(GetShort(repo))
+			h := http.HandlerFunc(GetShort(repo, clicks))
 			h.ServeHTTP(w, request)
 			res := w.Result()
 			defer res.Body.Close()
@@ -134,6 +266,55 @@ func TestGetShort(t *testing.T) {
 			assert.EqualValues(t, tt.want.code, res.StatusCode)
 		})
 	}
+	// переход записывается только для успешного редиректа
+	assert.Equal(t, []string{testCode}, clicks.shorts)
+}
+
+func TestStats(t *testing.T) {
+	stats := model.ClickStats{
+		Total:  3,
+		Unique: 2,
+		Daily:  []model.DayClicks{{Day: "2022-03-01", Clicks: 1}, {Day: "2022-03-02", Clicks: 2}},
+	}
+	tests := []struct {
+		name  string
+		short string
+		code  int
+	}{
+		{name: "own link", short: testCode, code: http.StatusOK},
+		{name: "foreign link", short: "foreign", code: http.StatusNotFound},
+	}
+	repo := new(mocks.RepoDBModel)
+	repo.On("GetItem", model.User(testUser), testCode, mock.Anything).Return(model.Link{URL: testURL}, nil)
+	repo.On("GetItem", model.User(testUser), "foreign", mock.Anything).Return(model.Link{}, model.ErrNotFound)
+	store := new(testStats)
+	store.stats = stats
+	r := chi.NewRouter()
+	r.Get("/api/user/urls/{short}/stats", Stats(repo, store))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+tt.short+"/stats", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.EqualValues(t, tt.code, res.StatusCode)
+			if tt.code == http.StatusOK {
+				var got model.ClickStats
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+				assert.Equal(t, stats, got)
+			}
+		})
+	}
+}
+
+// testStats отдает заранее заданную статистику.
+type testStats struct {
+	stats model.ClickStats
+}
+
+func (s *testStats) ClickStats(context.Context, string) (model.ClickStats, error) {
+	return s.stats, nil
 }
 
 func TestAPICreateShort(t *testing.T) {
@@ -153,7 +334,7 @@ func TestAPICreateShort(t *testing.T) {
 			addItemResult: nil,
 			want: want{
 				code:        http.StatusCreated,
-				contentType: "",
+				contentType: "text/plain; charset=utf-8",
 			},
 		},
 		{
@@ -177,16 +358,15 @@ func TestAPICreateShort(t *testing.T) {
 	}
 
 	repo := new(mocks.RepoDBModel)
-	repo.On("CheckExist", model.User(testUser), testCode).Return(false)
+	repo.On("CheckExist", testCode).Return(false)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.payload))
-			repo.On("GetItem", model.User(testUser), testCode, request.Context()).Return(model.Link{}, errors.New("not found"))
-			repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: tt.payload}, request.Context()).Return(tt.addItemResult)
-			repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: ""}, request.Context()).Return(tt.addItemResult)
+			repo.On("GetByOrigin", model.User(testUser), tt.payload, request.Context()).Return("", model.ErrNotFound)
+			repo.On("AddItem", model.User(testUser), testCode, model.Link{URL: tt.payload, RawURL: tt.payload}, request.Context()).Return(tt.addItemResult)
 			w := httptest.NewRecorder()
-			h := http.HandlerFunc(CreateShort(repo, cfg.BaseURL))
+			h := http.HandlerFunc(CreateShort(repo, testCodes, testCheck, cfg.BaseURL))
 			h.ServeHTTP(w, request)
 			res := w.Result()
 			defer res.Body.Close()
@@ -199,6 +379,66 @@ func TestAPICreateShort(t *testing.T) {
 	}
 }
 
+func TestAPICreateShortAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		addErr  error
+		code    int
+		addCall bool
+	}{
+		{name: "free alias", alias: "spring-sale", code: http.StatusCreated, addCall: true},
+		{name: "taken alias", alias: "spring-sale", addErr: model.ErrCodeTaken, code: http.StatusConflict, addCall: true},
+		{name: "bad symbols", alias: "spring/sale", code: http.StatusBadRequest},
+		{name: "reserved", alias: "api", code: http.StatusBadRequest},
+		{name: "too long", alias: strings.Repeat("a", maxAliasLength+1), code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.RepoDBModel)
+			payload := `{"url":"` + testURL + `","alias":"` + tt.alias + `"}`
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(payload))
+			link := model.Link{URL: testURL, RawURL: testURL, Alias: tt.alias}
+			repo.On("GetByOrigin", model.User(testUser), testURL, request.Context()).Return("", model.ErrNotFound)
+			repo.On("AddItem", model.User(testUser), tt.alias, link, request.Context()).Return(tt.addErr)
+			w := httptest.NewRecorder()
+			h := http.HandlerFunc(APICreateShort(repo, testCodes, testCheck, cfg.BaseURL))
+			h.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.EqualValues(t, tt.code, res.StatusCode)
+			if tt.addCall {
+				repo.AssertCalled(t, "AddItem", model.User(testUser), tt.alias, link, request.Context())
+			} else {
+				repo.AssertNotCalled(t, "AddItem", model.User(testUser), tt.alias, link, request.Context())
+			}
+		})
+	}
+}
+
+func TestAPICreateShortTTL(t *testing.T) {
+	repo := new(mocks.RepoDBModel)
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"`+testURL+`","ttl_seconds":60}`))
+	repo.On("GetByOrigin", model.User(testUser), testURL, request.Context()).Return("", model.ErrNotFound)
+	repo.On("CheckExist", testCode).Return(false)
+	repo.On("AddItem", model.User(testUser), testCode, mock.MatchedBy(func(link model.Link) bool {
+		return link.ExpiresAt != nil && link.ExpiresAt.After(time.Now()) && link.TTL == 0
+	}), request.Context()).Return(nil)
+	w := httptest.NewRecorder()
+	h := http.HandlerFunc(APICreateShort(repo, testCodes, testCheck, cfg.BaseURL))
+	h.ServeHTTP(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+	assert.EqualValues(t, http.StatusCreated, res.StatusCode)
+
+	request = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"`+testURL+`","expires_at":"2001-01-01T00:00:00Z"}`))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, request)
+	res = w.Result()
+	defer res.Body.Close()
+	assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+}
+
 func TestBunchSaveJSON(t *testing.T) {
 	type want struct {
 		code int
@@ -221,17 +461,25 @@ func TestBunchSaveJSON(t *testing.T) {
 				code: http.StatusCreated,
 			},
 		},
+		{
+			name:    "#2 storage error",
+			payload: `[{"correlation_id":"1","original_url":"` + testURL + `fail"}]`,
+			want: want{
+				code: http.StatusInternalServerError,
+			},
+		},
 	}
 
 	repo := new(mocks.RepoDBModel)
-	repo.On("CheckExist", model.User(testUser), testCode).Return(false)
-	repo.On("BunchSave", context.Background(), model.User(testUser), []model.Link{{ID: "1", URL: testURL}}).Return([]model.ShortLink{{ID: "1", Short: testCode}}, nil)
+	repo.On("CheckExist", testCode).Return(false)
+	repo.On("BunchSave", context.Background(), model.User(testUser), []model.Link{{ID: "1", URL: testURL, RawURL: testURL}}).Return([]model.ShortLink{{ID: "1", Short: testCode}}, nil)
+	repo.On("BunchSave", context.Background(), model.User(testUser), []model.Link{{ID: "1", URL: testURL + "fail", RawURL: testURL + "fail"}}).Return(nil, errors.New("connection refused"))
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.payload))
 			w := httptest.NewRecorder()
-			h := http.HandlerFunc(BunchSaveJSON(repo, cfg.BaseURL))
+			h := http.HandlerFunc(BunchSaveJSON(repo, testCheck, cfg.BaseURL))
 			h.ServeHTTP(w, request)
 			res := w.Result()
 			defer res.Body.Close()
@@ -241,10 +489,56 @@ func TestBunchSaveJSON(t *testing.T) {
 	}
 }
 
+func TestBunchSaveJSONConflict(t *testing.T) {
+	payload := `[{"correlation_id":"1","original_url":"` + testURL + `"},{"correlation_id":"2","original_url":"` + testURL + `2"}]`
+	links := []model.Link{{ID: "1", URL: testURL, RawURL: testURL}, {ID: "2", URL: testURL + "2", RawURL: testURL + "2"}}
+	tests := []struct {
+		name   string
+		shorts []model.ShortLink
+		code   int
+		want   []BatchResult
+	}{
+		{
+			name:   "partial conflict",
+			shorts: []model.ShortLink{{ID: "1", Short: testCode}, {ID: "2", Short: "stored", Err: model.ErrOriginExists}},
+			code:   http.StatusCreated,
+			want: []BatchResult{
+				{ID: "1", Short: cfg.BaseURL + "/" + testCode, Status: http.StatusCreated},
+				{ID: "2", Short: cfg.BaseURL + "/stored", Status: http.StatusConflict, Error: model.ErrOriginExists.Error()},
+			},
+		},
+		{
+			name:   "all conflict",
+			shorts: []model.ShortLink{{ID: "1", Short: "one", Err: model.ErrOriginExists}, {ID: "2", Err: model.ErrCodeTaken}},
+			code:   http.StatusConflict,
+			want: []BatchResult{
+				{ID: "1", Short: cfg.BaseURL + "/one", Status: http.StatusConflict, Error: model.ErrOriginExists.Error()},
+				{ID: "2", Status: http.StatusConflict, Error: model.ErrCodeTaken.Error()},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mocks.RepoDBModel)
+			repo.On("BunchSave", context.Background(), model.User(testUser), links).Return(tt.shorts, nil)
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+			w := httptest.NewRecorder()
+			h := http.HandlerFunc(BunchSaveJSON(repo, testCheck, cfg.BaseURL))
+			h.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.EqualValues(t, tt.code, res.StatusCode)
+			var got []BatchResult
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func ExampleBunchSaveJSON() {
 	repo := new(mocks.RepoDBModel)
 	r := chi.NewRouter()
-	r.Post("/api/shorten/batch", BunchSaveJSON(repo, "http://example.com"))
+	r.Post("/api/shorten/batch", BunchSaveJSON(repo, testCheck, "http://example.com"))
 
 }
 
@@ -264,6 +558,364 @@ func BenchmarkCreateShort(b *testing.B) {
 		b.StopTimer()
 		url := RandStringBytes(10)
 		b.StartTimer()
-		CreateShort(repo, url)
+		CreateShort(repo, testCodes, testCheck, url)
+	}
+}
+
+// testQueue запоминает поставленные задачи удаления.
+type testQueue struct {
+	jobs map[string]model.DeleteJob
+}
+
+func (q *testQueue) Submit(_ context.Context, user model.User, items []string) (model.DeleteJob, error) {
+	job := model.DeleteJob{ID: fmt.Sprint(len(q.jobs) + 1), User: user, Items: items, Status: model.JobQueued, Total: len(items)}
+	q.jobs[job.ID] = job
+	return job, nil
+}
+
+func (q *testQueue) Status(_ context.Context, user model.User, id string) (model.DeleteJob, error) {
+	job, ok := q.jobs[id]
+	if !ok || job.User != user {
+		return model.DeleteJob{}, model.ErrNotFound
+	}
+	return job, nil
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		code  int
+		items []string
+	}{
+		{name: "codes and ids", body: `["abc", 12]`, code: http.StatusAccepted, items: []string{"abc", "12"}},
+		{name: "empty", body: `[]`, code: http.StatusBadRequest},
+		{name: "not a list", body: `{"id": 1}`, code: http.StatusBadRequest},
+		{name: "nested", body: `[["abc"]]`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &testQueue{jobs: map[string]model.DeleteJob{}}
+			request := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			Delete(q)(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code != http.StatusAccepted {
+				assert.Empty(t, q.jobs)
+				return
+			}
+			var job model.DeleteJob
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+			assert.Equal(t, model.JobQueued, job.Status)
+			assert.Equal(t, tt.items, q.jobs[job.ID].Items)
+		})
+	}
+}
+
+func TestDeleteStatus(t *testing.T) {
+	q := &testQueue{jobs: map[string]model.DeleteJob{
+		"1": {ID: "1", User: testUser, Status: model.JobDone, Total: 2, Deleted: 2},
+		"2": {ID: "2", User: "stranger", Status: model.JobDone},
+	}}
+	r := chi.NewRouter()
+	r.Get("/api/user/urls/delete/{job}", DeleteStatus(q))
+	tests := []struct {
+		name string
+		job  string
+		code int
+	}{
+		{name: "own job", job: "1", code: http.StatusOK},
+		{name: "foreign job", job: "2", code: http.StatusNotFound},
+		{name: "unknown job", job: "3", code: http.StatusNotFound},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/urls/delete/"+tt.job, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+			if tt.code == http.StatusOK {
+				var job model.DeleteJob
+				assert.NoError(t, json.NewDecoder(res.Body).Decode(&job))
+				assert.Equal(t, q.jobs["1"].Deleted, job.Deleted)
+				assert.Equal(t, model.JobDone, job.Status)
+			}
+		})
+	}
+}
+
+func TestGetUserShorts(t *testing.T) {
+	createdAt := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	older := model.Link{Short: "older", URL: testURL + "older", Seq: 1, CreatedAt: createdAt}
+	newer := model.Link{Short: testCode, URL: testURL, RawURL: "HTTPS://yandex.ru", Seq: 2, CreatedAt: createdAt.Add(time.Hour), Deleted: true}
+	cursor := model.CursorOf(newer)
+	tests := []struct {
+		name   string
+		user   string
+		target string
+		query  model.UserLinksQuery
+		links  []model.Link
+		err    error
+		code   int
+		body   string
+		next   string
+	}{
+		{
+			name:   "links",
+			user:   "u1",
+			target: "/user/urls",
+			query:  model.UserLinksQuery{Limit: 101, Desc: true},
+			links:  []model.Link{older},
+			code:   http.StatusOK,
+			body:   `[{"short_url":"older","original_url":"` + testURL + `older","created_at":"2022-03-01T12:00:00Z"}]`,
+		},
+		{
+			name:   "next page",
+			user:   "u2",
+			target: "/user/urls?limit=1&order=asc&q=yandex&include_deleted=true",
+			query:  model.UserLinksQuery{Limit: 2, Contains: "yandex", IncludeDeleted: true},
+			links:  []model.Link{newer, older},
+			code:   http.StatusOK,
+			body:   `[{"short_url":"` + testCode + `","original_url":"` + testURL + `","raw_url":"HTTPS://yandex.ru","created_at":"2022-03-01T13:00:00Z","deleted":true}]`,
+			next:   cursor.String(),
+		},
+		{
+			name:   "after cursor",
+			user:   "u3",
+			target: "/user/urls?cursor=" + cursor.String(),
+			query:  model.UserLinksQuery{Limit: 101, Desc: true, After: &cursor},
+			links:  []model.Link{},
+			code:   http.StatusNoContent,
+		},
+		{name: "bad limit", user: "u4", target: "/user/urls?limit=0", code: http.StatusBadRequest, body: "limit must be from 1 to 1000\n"},
+		{name: "bad cursor", user: "u4", target: "/user/urls?cursor=~", code: http.StatusBadRequest, body: "invalid cursor\n"},
+		{name: "bad order", user: "u4", target: "/user/urls?order=up", code: http.StatusBadRequest, body: "order must be asc or desc\n"},
+		{
+			name:   "storage error",
+			user:   "u5",
+			target: "/user/urls",
+			query:  model.UserLinksQuery{Limit: 101, Desc: true},
+			err:    errors.New("connection refused"),
+			code:   http.StatusInternalServerError,
+			body:   "internal error\n",
+		},
+	}
+	repo := new(mocks.RepoDBModel)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.On("GetByUser", model.User(tt.user), tt.query, mock.Anything).Return(tt.links, tt.err)
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			request = request.WithContext(context.WithValue(request.Context(), middlewares.UserIDCtxName, tt.user))
+			w := httptest.NewRecorder()
+			GetUserShorts(repo)(w, request)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.next, w.Header().Get("X-Next-Cursor"))
+			if tt.code == http.StatusOK {
+				assert.JSONEq(t, tt.body, w.Body.String())
+			} else {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestInternalStats(t *testing.T) {
+	repo := new(mocks.RepoDBModel)
+	repo.On("ServiceStats", mock.Anything).Return(model.ServiceStats{URLs: 5, Users: 2}, nil)
+	request := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+	w := httptest.NewRecorder()
+	InternalStats(repo)(w, request)
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.JSONEq(t, `{"urls": 5, "users": 2}`, string(body))
+}
+
+// importEvents разбирает ответ импорта построчно.
+func importEvents(t *testing.T, body io.Reader) (rows []ImportRow, progress []ImportProgress, fatal *httperror.Error) {
+	t.Helper()
+	dec := json.NewDecoder(body)
+	for dec.More() {
+		var event importEvent
+		require.NoError(t, dec.Decode(&event))
+		if event.Row != nil {
+			rows = append(rows, *event.Row)
+		}
+		if event.Progress != nil {
+			progress = append(progress, *event.Progress)
+		}
+		if event.Error != nil {
+			fatal = event.Error
+		}
+	}
+	return rows, progress, fatal
+}
+
+func TestImport(t *testing.T) {
+	type row struct {
+		line  int
+		short string
+		code  string
+	}
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		status      int
+		rows        []row
+		done        ImportProgress
+	}{
+		{
+			name:        "jsonl",
+			target:      "/api/shorten/import",
+			contentType: "application/x-ndjson",
+			body: `{"correlation_id":"1","original_url":"https://a.ru"}` + "\n\n" +
+				`{"correlation_id":"2","original_url":` + "\n" +
+				`{"correlation_id":"3","original_url":"http://localhost"}` + "\n" +
+				`{"correlation_id":"4","original_url":"HTTPS://A.ru/","alias":"a-dup"}` + "\n" +
+				`{"correlation_id":"5","original_url":"https://b.ru","alias":"b-link","ttl_seconds":60}`,
+			status: http.StatusOK,
+			rows: []row{
+				{line: 3, code: httperror.CodeInvalidJSON},
+				{line: 4, code: urlcheck.ReasonPrivate},
+				{line: 1, short: "*"},
+				{line: 5, short: "*", code: httperror.CodeConflict},
+				{line: 6, short: cfg.BaseURL + "/b-link"},
+			},
+			done: ImportProgress{Rows: 5, Saved: 2, Failed: 3, Done: true},
+		},
+		{
+			name:        "csv",
+			target:      "/api/shorten/import?format=csv",
+			contentType: "application/octet-stream",
+			body: "correlation_id, Original_URL,expires_at\n" +
+				"1,https://c.ru,\n" +
+				"2,https://d.ru,tomorrow\n" +
+				"3,\"https://e.ru\"x,\n" +
+				"4\n" +
+				"5,https://f.ru,2100-01-01T00:00:00Z\n",
+			status: http.StatusOK,
+			rows: []row{
+				{line: 3, code: httperror.CodeInvalidExpiry},
+				{line: 4, code: httperror.CodeBadRequest},
+				{line: 5, code: urlcheck.ReasonInvalid},
+				{line: 2, short: "*"},
+				{line: 6, short: "*"},
+			},
+			done: ImportProgress{Rows: 5, Saved: 2, Failed: 3, Done: true},
+		},
+		{name: "unknown format", target: "/api/shorten/import", contentType: "application/json", body: "[]", status: http.StatusUnsupportedMediaType},
+		{name: "no url column", target: "/api/shorten/import", contentType: "text/csv", body: "id,url\n1,https://a.ru\n", status: http.StatusBadRequest},
+	}
+	repo := repository.New("", shortcode.NewAllocator(shortcode.NewHash(8), 3))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			Import(repo, testCheck, cfg.BaseURL)(w, request)
+			require.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				var envelope struct{ Error httperror.Error }
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envelope))
+				assert.NotEmpty(t, envelope.Error.Code)
+				return
+			}
+			assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+			rows, progress, fatal := importEvents(t, w.Body)
+			assert.Nil(t, fatal)
+			require.Len(t, rows, len(tt.rows))
+			for i, want := range tt.rows {
+				got := rows[i]
+				assert.Equal(t, want.line, got.Line, "row %d", i)
+				switch want.short {
+				case "":
+					assert.Empty(t, got.Short, "row %d", i)
+				case "*":
+					assert.True(t, strings.HasPrefix(got.Short, cfg.BaseURL+"/"), "row %d", i)
+				default:
+					assert.Equal(t, want.short, got.Short, "row %d", i)
+				}
+				if want.code == "" {
+					assert.Nil(t, got.Error, "row %d", i)
+				} else if assert.NotNil(t, got.Error, "row %d", i) {
+					assert.Equal(t, want.code, got.Error.Code, "row %d", i)
+				}
+			}
+			require.NotEmpty(t, progress)
+			assert.Equal(t, tt.done, progress[len(progress)-1])
+		})
+	}
+}
+
+func TestImportChunks(t *testing.T) {
+	var body strings.Builder
+	rows := importChunk*2 + 500
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&body, "{\"correlation_id\":\"%d\",\"original_url\":\"https://example.org/%d\"}\n", i, i)
+	}
+	repo := repository.New("", shortcode.NewAllocator(shortcode.NewHash(8), 3))
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/import?format=jsonl", strings.NewReader(body.String()))
+	w := httptest.NewRecorder()
+	Import(repo, testCheck, cfg.BaseURL)(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	results, progress, fatal := importEvents(t, w.Body)
+	assert.Nil(t, fatal)
+	assert.Len(t, results, rows)
+	assert.Equal(t, []ImportProgress{
+		{Rows: importChunk, Saved: importChunk},
+		{Rows: importChunk * 2, Saved: importChunk * 2},
+		{Rows: rows, Saved: rows},
+		{Rows: rows, Saved: rows, Done: true},
+	}, progress)
+}
+
+func TestImportStorageError(t *testing.T) {
+	repo := new(mocks.RepoDBModel)
+	repo.On("BunchSave", mock.Anything, testUser, mock.Anything).Return(nil, errors.New("connection refused"))
+	request := httptest.NewRequest(http.MethodPost, "/api/shorten/import", strings.NewReader(`{"original_url":"https://a.ru"}`))
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	Import(repo, testCheck, cfg.BaseURL)(w, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	rows, progress, fatal := importEvents(t, w.Body)
+	assert.Empty(t, rows)
+	require.NotNil(t, fatal)
+	assert.Equal(t, httperror.CodeInternal, fatal.Code)
+	assert.Equal(t, []ImportProgress{{}}, progress)
+}
+
+func TestImportServer(t *testing.T) {
+	repo := repository.New("", shortcode.NewAllocator(shortcode.NewHash(8), 3))
+	srv := httptest.NewServer(middlewares.GzipHandle(Import(repo, testCheck, cfg.BaseURL)))
+	defer srv.Close()
+
+	rows := importChunk*2 + 500
+	body, upload := io.Pipe()
+	go func() {
+		for i := 0; i < rows; i++ {
+			if _, err := fmt.Fprintf(upload, "{\"correlation_id\":\"%d\",\"original_url\":\"https://example.net/%d\"}\n", i, i); err != nil {
+				return
+			}
+		}
+		upload.Close()
+	}()
+	request, err := http.NewRequest(http.MethodPost, srv.URL+"/api/shorten/import?format=jsonl", body)
+	require.NoError(t, err)
+	// тело без длины уходит по частям
+	res, err := srv.Client().Do(request)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	results, progress, fatal := importEvents(t, res.Body)
+	assert.Nil(t, fatal)
+	assert.Len(t, results, rows)
+	require.NotEmpty(t, progress)
+	assert.Equal(t, ImportProgress{Rows: rows, Saved: rows, Done: true}, progress[len(progress)-1])
 }
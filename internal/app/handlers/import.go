@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ilyakasharokov/internal/app/httperror"
+	"ilyakasharokov/internal/app/middlewares"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/urlcheck"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+// importChunk число строк импорта, сохраняемых одним вызовом BunchSave.
+const importChunk = 1000
+
+// maxImportLine наибольшая длина строки JSON Lines.
+const maxImportLine = 64 * 1024
+
+// ImportRow результат строки импорта. Line номер строки во входном фаиле, считая с 1.
+type ImportRow struct {
+	Line  int              `json:"line"`
+	ID    string           `json:"correlation_id,omitempty"`
+	Short string           `json:"short_url,omitempty"`
+	Error *httperror.Error `json:"error,omitempty"`
+}
+
+// ImportProgress счетчики строк импорта.
+type ImportProgress struct {
+	Rows   int  `json:"rows"`
+	Saved  int  `json:"saved"`
+	Failed int  `json:"failed"`
+	Done   bool `json:"done"`
+}
+
+// importEvent строка ответа импорта. Error ошибка, прервавшая импорт.
+type importEvent struct {
+	Row      *ImportRow       `json:"row,omitempty"`
+	Progress *ImportProgress  `json:"progress,omitempty"`
+	Error    *httperror.Error `json:"error,omitempty"`
+}
+
+// importReader читает ссылки из тела запроса по одной.
+type importReader interface {
+	// next возвращает ссылку и номер строки, io.EOF в конце. Ошибка *httperror.Error относится
+	// только к этой строке, остальные прерывают импорт.
+	next() (model.Link, int, error)
+}
+
+// Import потоково загружает ссылки в формате JSON Lines или CSV с заголовком, формат задается
+// параметром format или Content-Type. Поля строки те же, что в /api/shorten/batch.
+// Ссылки сохраняются частями по importChunk, ответ в формате JSON Lines: результат каждой строки
+// и счетчики после каждой части. Ошибки отдельных строк не прерывают импорт.
+func Import(repo RepoDBModel, check *urlcheck.Checker, baseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userIDCtx := r.Context().Value(middlewares.UserIDCtxName)
+		userID := "default"
+		if userIDCtx != nil {
+			// Convert interface type to user.UniqUser
+			userID = userIDCtx.(string)
+		}
+		rows, err := importRows(r)
+		if err != nil {
+			httperror.Write(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		// без полного дуплекса HTTP/1.1 сервер закрывает тело запроса при первом Flush ответа
+		if err := http.NewResponseController(w).EnableFullDuplex(); err != nil {
+			zerolog.Ctx(r.Context()).Debug().Err(err).Msg("Full duplex is not supported")
+		}
+		w.WriteHeader(http.StatusOK)
+		imp := &importer{
+			ctx:     r.Context(),
+			repo:    repo,
+			user:    model.User(userID),
+			baseURL: baseURL,
+			enc:     json.NewEncoder(w),
+		}
+		imp.flusher, _ = w.(http.Flusher)
+		now := time.Now()
+		for err == nil {
+			var link model.Link
+			var line int
+			link, line, err = rows.next()
+			if err == io.EOF {
+				err = imp.save()
+				break
+			}
+			var rowErr *httperror.Error
+			switch {
+			case errors.As(err, &rowErr):
+				imp.fail(line, link.ID, rowErr)
+				err = nil
+			case err != nil:
+				err = httperror.BadRequest(httperror.CodeBadRequest, err.Error())
+			default:
+				if prepared := prepareLink(r.Context(), check, &link, now); prepared != nil {
+					imp.fail(line, link.ID, httperror.From(prepared))
+					break
+				}
+				err = imp.add(line, link)
+			}
+		}
+		if err != nil {
+			e := *httperror.From(err)
+			e.RequestID = middleware.GetReqID(r.Context())
+			zerolog.Ctx(r.Context()).Err(err).Int("rows", imp.progress.Rows).Msg("Import aborted")
+			imp.write(importEvent{Error: &e, Progress: &imp.progress})
+			return
+		}
+		imp.progress.Done = true
+		imp.write(importEvent{Progress: &imp.progress})
+	}
+}
+
+// prepareLink проверяет ссылку пакета: URL приводится к каноническому виду, TTL пересчитывается в срок действия.
+func prepareLink(ctx context.Context, check *urlcheck.Checker, link *model.Link, now time.Time) error {
+	link.RawURL = link.URL
+	var err error
+	if link.URL, err = check.Check(ctx, link.URL); err != nil {
+		return urlError(err)
+	}
+	if link.Alias != "" && !ValidAlias(link.Alias) {
+		return httperror.BadRequest(httperror.CodeInvalidAlias, "the alias is incorrect: "+link.Alias)
+	}
+	return link.ResolveExpiry(now)
+}
+
+// importer копит строки импорта и сохраняет их частями.
+type importer struct {
+	ctx      context.Context
+	repo     RepoDBModel
+	user     model.User
+	baseURL  string
+	enc      *json.Encoder
+	flusher  http.Flusher
+	progress ImportProgress
+	links    []model.Link
+	lines    []int
+}
+
+func (imp *importer) add(line int, link model.Link) error {
+	imp.links = append(imp.links, link)
+	imp.lines = append(imp.lines, line)
+	if len(imp.links) < importChunk {
+		return nil
+	}
+	return imp.save()
+}
+
+func (imp *importer) fail(line int, id string, err *httperror.Error) {
+	imp.progress.Rows++
+	imp.progress.Failed++
+	imp.write(importEvent{Row: &ImportRow{Line: line, ID: id, Error: err}})
+}
+
+// save сохраняет накопленные строки и отдает клиенту их результаты и счетчики.
+func (imp *importer) save() error {
+	if len(imp.links) == 0 {
+		return nil
+	}
+	shorts, err := imp.repo.BunchSave(imp.ctx, imp.user, imp.links)
+	if err != nil {
+		return httperror.Internal(err)
+	}
+	for i, short := range shorts {
+		row := ImportRow{Line: imp.lines[i], ID: short.ID}
+		if short.Short != "" {
+			row.Short = fmt.Sprintf("%s/%s", imp.baseURL, short.Short)
+		}
+		imp.progress.Rows++
+		if short.Err != nil {
+			row.Error = httperror.From(short.Err)
+			imp.progress.Failed++
+		} else {
+			imp.progress.Saved++
+		}
+		imp.write(importEvent{Row: &row})
+	}
+	imp.links, imp.lines = imp.links[:0], imp.lines[:0]
+	imp.write(importEvent{Progress: &imp.progress})
+	if imp.flusher != nil {
+		imp.flusher.Flush()
+	}
+	return nil
+}
+
+func (imp *importer) write(event importEvent) {
+	// клиент, закрывший соединение, увидит прерванный ответ, импорт завершится с отменой контекста
+	_ = imp.enc.Encode(event)
+}
+
+// importRows выбирает формат импорта по параметру format или Content-Type.
+func importRows(r *http.Request) (importReader, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, httperror.BadRequest(httperror.CodeBadRequest, "no content")
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format, _, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+	}
+	switch format {
+	case "csv", "text/csv":
+		return newCSVReader(r.Body)
+	case "jsonl", "ndjson", "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return newJSONLReader(r.Body), nil
+	}
+	return nil, httperror.New(http.StatusUnsupportedMediaType, httperror.CodeBadRequest, "format must be csv or jsonl")
+}
+
+// jsonlReader читает JSON Lines, пустые строки пропускаются.
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLReader(r io.Reader) *jsonlReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxImportLine)
+	return &jsonlReader{scanner: scanner}
+}
+
+func (r *jsonlReader) next() (model.Link, int, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var link model.Link
+		if err := json.Unmarshal(data, &link); err != nil {
+			return model.Link{}, r.line, httperror.BadRequest(httperror.CodeInvalidJSON, "bad json")
+		}
+		return link, r.line, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return model.Link{}, r.line + 1, fmt.Errorf("line %d: %w", r.line+1, err)
+	}
+	return model.Link{}, r.line, io.EOF
+}
+
+// csvReader читает CSV, колонки определяются по первой строке.
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, httperror.BadRequest(httperror.CodeBadRequest, "bad csv header")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil, httperror.BadRequest(httperror.CodeBadRequest, "csv header must contain original_url")
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvReader) next() (model.Link, int, error) {
+	record, err := r.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return model.Link{}, parseErr.StartLine, httperror.BadRequest(httperror.CodeBadRequest, parseErr.Err.Error())
+	}
+	if err != nil {
+		return model.Link{}, 0, err
+	}
+	line, _ := r.reader.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	link := model.Link{ID: field("correlation_id"), URL: field("original_url"), Alias: field("alias")}
+	if value := field("expires_at"); value != "" {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return link, line, httperror.BadRequest(httperror.CodeInvalidExpiry, "expires_at must be in RFC 3339 format")
+		}
+		link.ExpiresAt = &expiresAt
+	}
+	if value := field("ttl_seconds"); value != "" {
+		if link.TTL, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return link, line, httperror.BadRequest(httperror.CodeInvalidExpiry, "ttl_seconds must be an integer")
+		}
+	}
+	return link, line, nil
+}
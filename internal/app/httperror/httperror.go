@@ -0,0 +1,112 @@
+// Ошибки HTTP API с машиночитаемым кодом.
+package httperror
+
+import (
+	"encoding/json"
+	"errors"
+	"ilyakasharokov/internal/app/model"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+// Коды ошибок.
+const (
+	CodeBadRequest      = "bad_request"
+	CodeInvalidJSON     = "invalid_json"
+	CodeInvalidAlias    = "invalid_alias"
+	CodeInvalidExpiry   = "invalid_expiry"
+	CodeInvalidCursor   = "invalid_cursor"
+	CodeUnauthorized    = "unauthorized"
+	CodeForbidden       = "forbidden"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodeGone            = "gone"
+	CodeTooManyRequests = "too_many_requests"
+	CodeInternal        = "internal"
+)
+
+// Error ошибка ответа. На маршрутах /api/ отдается как JSON вида {"error": {...}}, на остальных текстом.
+type Error struct {
+	Status    int    `json:"-"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	// cause исходная ошибка, пишется в лог, но не клиенту.
+	cause error
+}
+
+func New(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest ошибка 400.
+func BadRequest(code string, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+// Internal ошибка 500, cause попадает только в лог.
+func Internal(cause error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, "internal error")
+	e.cause = cause
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// From приводит ошибку к Error. Ошибки хранилища превращаются в 404, 409 и 410, остальные в 500.
+func From(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, model.ErrNotFound):
+		return New(http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, model.ErrCodeTaken), errors.Is(err, model.ErrOriginExists):
+		return New(http.StatusConflict, CodeConflict, err.Error())
+	case errors.Is(err, model.ErrGone):
+		return New(http.StatusGone, CodeGone, err.Error())
+	case errors.Is(err, model.ErrBadExpiry):
+		return BadRequest(CodeInvalidExpiry, err.Error())
+	}
+	return Internal(err)
+}
+
+// JSON сообщает, отвечает ли маршрут ошибками в JSON.
+func JSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// Write отвечает ошибкой err. Ошибки 500 пишутся в лог запроса.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := *From(err)
+	e.RequestID = middleware.GetReqID(r.Context())
+	if e.Status >= http.StatusInternalServerError {
+		zerolog.Ctx(r.Context()).Err(e.cause).Str("code", e.Code).Msg(e.Message)
+	}
+	if e.RequestID != "" {
+		w.Header().Set("X-Request-Id", e.RequestID)
+	}
+	if !JSON(r) {
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+	body, _ := json.Marshal(struct {
+		Error *Error `json:"error"`
+	}{&e})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	w.Write(body)
+}
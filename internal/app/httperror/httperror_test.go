@@ -0,0 +1,95 @@
+package httperror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ilyakasharokov/internal/app/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{name: "error as is", err: BadRequest(CodeInvalidAlias, "bad alias"), status: http.StatusBadRequest, code: CodeInvalidAlias},
+		{name: "wrapped error", err: fmt.Errorf("save: %w", New(http.StatusForbidden, CodeForbidden, "no")), status: http.StatusForbidden, code: CodeForbidden},
+		{name: "not found", err: model.ErrNotFound, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "code taken", err: model.ErrCodeTaken, status: http.StatusConflict, code: CodeConflict},
+		{name: "origin exists", err: model.ErrOriginExists, status: http.StatusConflict, code: CodeConflict},
+		{name: "deleted", err: model.ErrDeleted, status: http.StatusGone, code: CodeGone},
+		{name: "expired", err: model.ErrExpired, status: http.StatusGone, code: CodeGone},
+		{name: "bad expiry", err: model.ErrBadExpiry, status: http.StatusBadRequest, code: CodeInvalidExpiry},
+		{name: "unknown", err: errors.New("connection refused"), status: http.StatusInternalServerError, code: CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := From(tt.err)
+			assert.Equal(t, tt.status, e.Status)
+			assert.Equal(t, tt.code, e.Code)
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		err         error
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "legacy text",
+			path:        "/abc",
+			err:         model.ErrNotFound,
+			status:      http.StatusNotFound,
+			contentType: "text/plain; charset=utf-8",
+			body:        "link not found\n",
+		},
+		{
+			name:        "api json",
+			path:        "/api/shorten",
+			err:         BadRequest(CodeInvalidJSON, "invalid json"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"error":{"code":"invalid_json","message":"invalid json","request_id":"req-1"}}`,
+		},
+		{
+			name:        "internal cause hidden",
+			path:        "/api/user/urls",
+			err:         errors.New("password authentication failed"),
+			status:      http.StatusInternalServerError,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"error":{"code":"internal","message":"internal error","request_id":"req-1"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r = r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, "req-1"))
+			w := httptest.NewRecorder()
+			Write(w, r, tt.err)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, "req-1", w.Header().Get("X-Request-Id"))
+			if JSON(r) {
+				require.True(t, json.Valid(w.Body.Bytes()))
+				assert.JSONEq(t, tt.body, w.Body.String())
+			} else {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,8 +1,42 @@
 // Логгер
 package logger
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	stdlog "log"
+	"os"
+	"time"
 
-func Info(action string, value string) {
-	fmt.Println(action, value)
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Форматы вывода логов.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// Init настраивает глобальный логгер zerolog: уровень (debug, info, warn, error) и формат json или console.
+// Стандартный log пишет через тот же логгер.
+func Init(level string, format string) error {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("log level %q: %w", level, err)
+	}
+	var w io.Writer
+	switch format {
+	case FormatJSON:
+		w = os.Stderr
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}
+	default:
+		return fmt.Errorf("unknown log format %q, use json or console", format)
+	}
+	zerolog.SetGlobalLevel(lvl)
+	log.Logger = zerolog.New(w).With().Timestamp().Logger()
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.Logger)
+	return nil
 }
@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInit(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{name: "json", level: "info", format: FormatJSON},
+		{name: "console", level: "debug", format: FormatConsole},
+		{name: "bad level", level: "loud", format: FormatJSON, wantErr: true},
+		{name: "bad format", level: "info", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Init(tt.level, tt.format)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			level, _ := zerolog.ParseLevel(tt.level)
+			assert.Equal(t, level, zerolog.GlobalLevel())
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Метрики сервиса в формате Prometheus.
+package metrics
+
+import (
+	"database/sql"
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/worker"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Результаты редиректа.
+const (
+	RedirectHit      = "hit"
+	RedirectNotFound = "not_found"
+	RedirectGone     = "gone"
+)
+
+// PoolStats источник состояния пула воркеров.
+type PoolStats interface {
+	Stats() worker.Stats
+}
+
+// CacheStats источник счетчиков кеша редиректов.
+type CacheStats interface {
+	Stats() model.CacheStats
+}
+
+type Metrics struct {
+	registry  *prometheus.Registry
+	requests  *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	redirects *prometheus.CounterVec
+}
+
+// New создает реестр с метриками HTTP и рантайма Go.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Short link lookups by result: hit, not_found or gone.",
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.redirects,
+	)
+	for _, result := range []string{RedirectHit, RedirectNotFound, RedirectGone} {
+		m.redirects.WithLabelValues(result)
+	}
+	return m
+}
+
+// Handler отдает метрики в текстовом формате Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware считает запросы и их длительность по шаблону маршрута chi.
+// Запросы, не совпавшие ни с одним маршрутом, попадают в route="unmatched".
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		code := strconv.Itoa(status(ww))
+		m.requests.WithLabelValues(route, r.Method, code).Inc()
+		m.duration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Redirects считает результаты редиректов по коду ответа.
+func (m *Metrics) Redirects(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		switch status(ww) {
+		case http.StatusTemporaryRedirect:
+			m.redirects.WithLabelValues(RedirectHit).Inc()
+		case http.StatusNotFound:
+			m.redirects.WithLabelValues(RedirectNotFound).Inc()
+		case http.StatusGone:
+			m.redirects.WithLabelValues(RedirectGone).Inc()
+		}
+	})
+}
+
+// status код ответа, обработчик без WriteHeader отвечает 200.
+func status(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
+
+// WatchPool добавляет метрики пула воркеров.
+func (m *Metrics) WatchPool(pool PoolStats) {
+	gauge := func(name string, help string, value func(worker.Stats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Subsystem: "worker", Name: name, Help: help},
+			func() float64 { return value(pool.Stats()) })
+	}
+	counter := func(name string, help string, value func(worker.Stats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Subsystem: "worker", Name: name, Help: help},
+			func() float64 { return value(pool.Stats()) })
+	}
+	m.registry.MustRegister(
+		gauge("workers", "Workers in the pool.", func(s worker.Stats) float64 { return float64(s.Workers) }),
+		gauge("queue_depth", "Tasks waiting in the queue.", func(s worker.Stats) float64 { return float64(s.Queued) }),
+		gauge("busy", "Workers running a task.", func(s worker.Stats) float64 { return float64(s.Busy) }),
+		counter("tasks_total", "Finished tasks.", func(s worker.Stats) float64 { return float64(s.Completed) }),
+		counter("task_failures_total", "Tasks finished with an error.", func(s worker.Stats) float64 { return float64(s.Failed) }),
+	)
+}
+
+// WatchDB добавляет статистику пула соединений с базой.
+func (m *Metrics) WatchDB(db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// WatchCache добавляет счетчики кеша редиректов и долю попаданий.
+func (m *Metrics) WatchCache(cache CacheStats) {
+	gauge := func(name string, help string, value func(model.CacheStats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Subsystem: "cache", Name: name, Help: help},
+			func() float64 { return value(cache.Stats()) })
+	}
+	counter := func(name string, help string, value func(model.CacheStats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Subsystem: "cache", Name: name, Help: help},
+			func() float64 { return value(cache.Stats()) })
+	}
+	m.registry.MustRegister(
+		counter("hits_total", "Lookups served from the cache.", func(s model.CacheStats) float64 { return float64(s.Hits) }),
+		counter("misses_total", "Lookups passed to the repository.", func(s model.CacheStats) float64 { return float64(s.Misses) }),
+		counter("evictions_total", "Entries evicted to stay within the size limit.", func(s model.CacheStats) float64 { return float64(s.Evictions) }),
+		gauge("entries", "Entries in the cache.", func(s model.CacheStats) float64 { return float64(s.Size) }),
+		gauge("hit_ratio", "Share of lookups served from the cache since start.", func(s model.CacheStats) float64 {
+			if s.Hits+s.Misses == 0 {
+				return 0
+			}
+			return float64(s.Hits) / float64(s.Hits+s.Misses)
+		}),
+	)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/worker"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPool struct{}
+
+func (testPool) Stats() worker.Stats {
+	return worker.Stats{Workers: 5, Queued: 3, Busy: 2, Completed: 10, Failed: 1}
+}
+
+type testCache struct{}
+
+func (testCache) Stats() model.CacheStats {
+	return model.CacheStats{Hits: 3, Misses: 1, Size: 2}
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.WatchPool(testPool{})
+	m.WatchCache(testCache{})
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.With(m.Redirects).Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch chi.URLParam(r, "id") {
+		case "hit":
+			http.Redirect(w, r, "https://ya.ru", http.StatusTemporaryRedirect)
+		case "gone":
+			http.Error(w, "Deleted", http.StatusGone)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	})
+	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	for _, path := range []string{"/hit", "/hit", "/gone", "/missing", "/ping", "/a/b"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	body := scrape(t, m)
+	for _, line := range []string{
+		`shortener_http_requests_total{code="307",method="GET",route="/{id}"} 2`,
+		`shortener_http_requests_total{code="200",method="GET",route="/ping"} 1`,
+		`shortener_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`shortener_http_request_duration_seconds_count{code="410",method="GET",route="/{id}"} 1`,
+		`shortener_redirects_total{result="hit"} 2`,
+		`shortener_redirects_total{result="gone"} 1`,
+		`shortener_redirects_total{result="not_found"} 1`,
+		`shortener_worker_queue_depth 3`,
+		`shortener_worker_busy 2`,
+		`shortener_worker_task_failures_total 1`,
+		`shortener_cache_hits_total 3`,
+		`shortener_cache_hit_ratio 0.75`,
+		`go_goroutines`,
+	} {
+		assert.Contains(t, body, line)
+	}
+}
@@ -2,11 +2,14 @@ package middlewares
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	helpers "ilyakasharokov/internal/app/encryptor"
+	"ilyakasharokov/internal/app/httperror"
 	"net/http"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 )
 
 // CookieUserIDName define cookie name for uuid
@@ -17,29 +20,67 @@ type ContextType string
 
 var UserIDCtxName ContextType = "ctxUserId"
 
-func CookieMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Generate new uuid
-		userID := uuid.New().String()
-		// Check if set cookie
-		if cookieUserID, err := r.Cookie(CookieUserIDName); err == nil {
-			// logger.Info("cookieUserId", zap.String("cookieUserId", cookieUserID.Value))
-			_ = helpers.Decode(cookieUserID.Value, &userID)
+// Identify возвращает пользователя по токену и новый токен, если его нужно выдать.
+// Пустой токен означает нового пользователя. Поддельный, подписанный неизвестным ключом
+// или просроченный токен возвращает ошибку. Токен, подписанный старым ключом или
+// проживший больше половины срока, перевыпускается.
+func Identify(kr *helpers.Keyring, token string) (userID string, issued string, err error) {
+	reissue := true
+	if token == "" {
+		userID = uuid.New().String()
+	} else {
+		t, err := kr.Decode(token)
+		if err != nil {
+			return "", "", err
 		}
-		// Generate hash from userId
-		encoded, err := helpers.Encode(userID)
-		// logger.Info("User ID", zap.String("ID", userID))
-		// logger.Info("User encoded", zap.String("Encoded", encoded))
-		if err == nil {
-			cookie := &http.Cookie{
-				Name:  CookieUserIDName,
-				Value: encoded,
-				Path:  "/",
+		userID = t.UserID
+		reissue = t.KeyID != kr.Active() || t.ExpiresAt.Sub(kr.Now()) < kr.TTL()/2
+	}
+	if reissue {
+		issued, err = kr.Encode(userID)
+	}
+	return userID, issued, err
+}
+
+// Cookie определяет пользователя по подписанной куке, см. Identify.
+// Вместо отклоненной куки выдается новый пользователь. Только запросы к ссылкам пользователя
+// /api/user/ получают 401, чтобы не показать чужому пустой список, кука при этом стирается.
+func Cookie(kr *helpers.Keyring) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			if cookieUserID, err := r.Cookie(CookieUserIDName); err == nil {
+				token = cookieUserID.Value
 			}
-			http.SetCookie(w, cookie)
-		} else {
-			fmt.Println(err)
-		}
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserIDCtxName, userID)))
-	})
+			userID, issued, err := Identify(kr, token)
+			if errors.Is(err, helpers.ErrInvalidToken) {
+				if strings.HasPrefix(r.URL.Path, "/api/user/") {
+					http.SetCookie(w, &http.Cookie{
+						Name:   CookieUserIDName,
+						Path:   "/",
+						MaxAge: -1,
+					})
+					httperror.Write(w, r, httperror.New(http.StatusUnauthorized, httperror.CodeUnauthorized, err.Error()))
+					return
+				}
+				zerolog.Ctx(r.Context()).Debug().Err(err).Msg("Cookie rejected, new user issued")
+				userID, issued, err = Identify(kr, "")
+			}
+			if err != nil {
+				zerolog.Ctx(r.Context()).Err(err).Msg("Issue cookie error")
+			}
+			logUser(r, userID)
+			if issued != "" {
+				http.SetCookie(w, &http.Cookie{
+					Name:     CookieUserIDName,
+					Value:    issued,
+					Path:     "/",
+					MaxAge:   int(kr.TTL().Seconds()),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), UserIDCtxName, userID)))
+		})
+	}
 }
@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	helpers "ilyakasharokov/internal/app/encryptor"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookie(t *testing.T) {
+	old, err := helpers.NewKeyring("k1:000102030405060708090a0b0c0d0e0f", time.Hour)
+	require.NoError(t, err)
+	kr, err := helpers.NewKeyring("k2:101112131415161718191a1b1c1d1e1f,k1:000102030405060708090a0b0c0d0e0f", time.Hour)
+	require.NoError(t, err)
+	current, err := kr.Encode("current")
+	require.NoError(t, err)
+	rotated, err := old.Encode("rotated")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		path    string
+		cookie  string
+		code    int
+		user    string
+		reissue bool
+	}{
+		{name: "no cookie", code: http.StatusOK, reissue: true},
+		{name: "active key", cookie: current, code: http.StatusOK, user: "current"},
+		{name: "old key", cookie: rotated, code: http.StatusOK, user: "rotated", reissue: true},
+		{name: "tampered", cookie: "k2.00", code: http.StatusOK, reissue: true},
+		{name: "unknown key", cookie: "k9." + current[3:], code: http.StatusOK, reissue: true},
+		{name: "tampered user links", path: "/api/user/urls", cookie: "k2.00", code: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user string
+			h := Cookie(kr)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user = r.Context().Value(UserIDCtxName).(string)
+			}))
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			request := httptest.NewRequest(http.MethodGet, path, nil)
+			if tt.cookie != "" {
+				request.AddCookie(&http.Cookie{Name: CookieUserIDName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.code, res.StatusCode)
+			cookies := res.Cookies()
+			if tt.code == http.StatusUnauthorized {
+				require.Len(t, cookies, 1)
+				assert.Equal(t, -1, cookies[0].MaxAge)
+				assert.Empty(t, user)
+				return
+			}
+			if tt.user != "" {
+				assert.Equal(t, tt.user, user)
+			} else {
+				assert.NotEmpty(t, user)
+			}
+			if !tt.reissue {
+				assert.Empty(t, cookies)
+				return
+			}
+			require.Len(t, cookies, 1)
+			token, err := kr.Decode(cookies[0].Value)
+			require.NoError(t, err)
+			assert.Equal(t, "k2", token.KeyID)
+			assert.Equal(t, user, token.UserID)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestLogger пишет одну строку на запрос: метод, шаблон маршрута, статус, размер ответа,
+// длительность, идентификатор запроса из middleware.RequestID и пользователя из Cookie.
+// Логгер запроса доступен обработчикам через zerolog.Ctx.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := log.With().Str("request_id", middleware.GetReqID(r.Context())).Logger()
+		r = r.WithContext(l.WithContext(r.Context()))
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		logger := zerolog.Ctx(r.Context())
+		event := logger.Info()
+		if status >= http.StatusInternalServerError {
+			event = logger.Error()
+		}
+		event.
+			Str("method", r.Method).
+			Str("route", route).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("duration", time.Since(start)).
+			Msg("Request")
+	})
+}
+
+// logUser добавляет пользователя в логгер запроса.
+func logUser(r *http.Request, userID string) {
+	zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("user_id", userID)
+	})
+}
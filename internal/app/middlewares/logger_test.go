@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	helpers "ilyakasharokov/internal/app/encryptor"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	old := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = old }()
+
+	kr, err := helpers.NewKeyring("k1:000102030405060708090a0b0c0d0e0f", time.Hour)
+	require.NoError(t, err)
+	token, err := kr.Encode("user-1")
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(RequestLogger)
+	r.Use(Cookie(kr))
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).Info().Msg("inside")
+		w.Write([]byte("hello"))
+	})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	request.Header.Set(middleware.RequestIDHeader, "req-1")
+	request.AddCookie(&http.Cookie{Name: CookieUserIDName, Value: token})
+	r.ServeHTTP(httptest.NewRecorder(), request)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+	}
+
+	// логгер запроса доступен обработчику
+	assert.Equal(t, "inside", entries[0]["message"])
+	assert.Equal(t, "req-1", entries[0]["request_id"])
+	assert.Equal(t, "user-1", entries[0]["user_id"])
+
+	assert.Equal(t, "info", entries[1]["level"])
+	assert.Equal(t, "Request", entries[1]["message"])
+	assert.Equal(t, "GET", entries[1]["method"])
+	assert.Equal(t, "/{id}", entries[1]["route"])
+	assert.EqualValues(t, http.StatusOK, entries[1]["status"])
+	assert.EqualValues(t, 5, entries[1]["bytes"])
+	assert.Equal(t, "req-1", entries[1]["request_id"])
+	assert.Equal(t, "user-1", entries[1]["user_id"])
+	assert.Contains(t, entries[1], "duration")
+
+	assert.Equal(t, "error", entries[2]["level"])
+	assert.Equal(t, "/fail", entries[2]["route"])
+	assert.EqualValues(t, http.StatusInternalServerError, entries[2]["status"])
+	assert.NotEmpty(t, entries[2]["request_id"])
+	assert.NotEmpty(t, entries[2]["user_id"])
+}
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"ilyakasharokov/internal/app/httperror"
+	"net"
+	"net/http"
+)
+
+// TrustedSubnet пропускает только клиентов из subnet, адрес берется из RealIP.
+// X-Real-IP учитывается, только если перед ним стоит TrustedProxies.
+// Без подсети все запросы отклоняются.
+func TrustedSubnet(subnet *net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := RealIP(r)
+			if subnet == nil || ip == nil || !subnet.Contains(ip) {
+				httperror.Write(w, r, httperror.New(http.StatusForbidden, httperror.CodeForbidden, "Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
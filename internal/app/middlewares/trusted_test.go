@@ -0,0 +1,78 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedSubnet(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.1.0/24")
+	proxies, _ := ParseProxies("10.0.0.0/8, 192.168.1.1")
+	tests := []struct {
+		name     string
+		subnet   *net.IPNet
+		realIP   string
+		forward  string
+		remote   string
+		wantCode int
+	}{
+		{name: "real ip from proxy inside", subnet: subnet, realIP: "192.168.1.10", remote: "10.0.0.1:1234", wantCode: http.StatusOK},
+		{name: "real ip from proxy outside", subnet: subnet, realIP: "192.168.2.10", remote: "192.168.1.1:1234", wantCode: http.StatusForbidden},
+		{name: "real ip from client is ignored", subnet: subnet, realIP: "192.168.1.10", remote: "172.16.0.1:1234", wantCode: http.StatusForbidden},
+		{name: "remote inside", subnet: subnet, remote: "192.168.1.5:1234", wantCode: http.StatusOK},
+		{name: "forwarded is ignored", subnet: subnet, forward: "192.168.1.5", remote: "10.0.0.1:1234", wantCode: http.StatusForbidden},
+		{name: "no subnet", remote: "192.168.1.5:1234", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := TrustedProxies(proxies)(TrustedSubnet(tt.subnet)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+			request := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			request.RemoteAddr = tt.remote
+			if tt.realIP != "" {
+				request.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forward != "" {
+				request.Header.Set("X-Forwarded-For", tt.forward)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+		})
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		inside  []string
+		outside []string
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "subnets and addresses", value: "10.0.0.0/8, 192.168.1.1,fd00::/8,::1", inside: []string{"10.1.2.3", "192.168.1.1", "fd00::5", "::1"}, outside: []string{"192.168.1.2", "11.0.0.1", "::2"}},
+		{name: "bad entry", value: "10.0.0.0/8,proxy", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := ParseProxies(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for _, ip := range tt.inside {
+				assert.True(t, contains(proxies, net.ParseIP(ip)), ip)
+			}
+			for _, ip := range tt.outside {
+				assert.False(t, contains(proxies, net.ParseIP(ip)), ip)
+			}
+		})
+	}
+}
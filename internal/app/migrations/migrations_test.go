@@ -0,0 +1,125 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := load(files)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"sql/0002_b.up.sql":   {Data: []byte("b up")},
+				"sql/0002_b.down.sql": {Data: []byte("b down")},
+				"sql/0001_a.up.sql":   {Data: []byte("a up")},
+				"sql/0001_a.down.sql": {Data: []byte("a down")},
+			},
+			want: []int{1, 2},
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"sql/0001_a.up.sql": {Data: []byte("a up")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad version",
+			fsys: fstest.MapFS{
+				"sql/first_a.up.sql":   {Data: []byte("a up")},
+				"sql/first_a.down.sql": {Data: []byte("a down")},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := load(tt.fsys)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var versions []int
+			for _, m := range got {
+				versions = append(versions, m.Version)
+			}
+			assert.Equal(t, tt.want, versions)
+		})
+	}
+}
+
+// TestUpDuplicateOrigins применяет миграции к базе из DATABASE_DSN, где до 0003 накопились
+// повторные сокращения одного URL.
+func TestUpDuplicateOrigins(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	// отдельная схема на одном соединении, чтобы не трогать рабочие таблицы
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	_, err = db.ExecContext(ctx, "create schema "+schema)
+	require.NoError(t, err)
+	defer db.ExecContext(ctx, "drop schema "+schema+" cascade")
+	_, err = db.ExecContext(ctx, "set search_path to "+schema)
+	require.NoError(t, err)
+
+	m, err := New(db)
+	require.NoError(t, err)
+	all := m.migrations
+	m.migrations = all[:2]
+	require.NoError(t, m.Up(ctx))
+	_, err = db.ExecContext(ctx, `
+		insert into urls (user_id, origin_url, short_url) values
+			('u1', 'https://a.ru', 'a1'), ('u1', 'https://a.ru', 'a2'), ('u1', 'https://a.ru', 'a3'),
+			('u2', 'https://a.ru', 'a4'), ('u1', 'https://b.ru', 'b1')
+	`)
+	require.NoError(t, err)
+
+	m.migrations = all
+	require.NoError(t, m.Up(ctx))
+	rows, err := db.QueryContext(ctx, `select short_url from urls order by id`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var shorts []string
+	for rows.Next() {
+		var short string
+		require.NoError(t, rows.Scan(&short))
+		shorts = append(shorts, short)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"a1", "a4", "b1"}, shorts)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS urls (
+    id             SERIAL PRIMARY KEY,
+    user_id        TEXT    NOT NULL,
+    origin_url     TEXT    NOT NULL,
+    short_url      TEXT    NOT NULL UNIQUE,
+    correlation_id TEXT,
+    deleted        BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS urls_user_id_idx ON urls (user_id);
@@ -0,0 +1,2 @@
+-- Индекс может обеспечивать ограничение из 0001_create_urls, поэтому при откате он сохраняется.
+SELECT 1;
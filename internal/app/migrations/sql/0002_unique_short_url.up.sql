@@ -0,0 +1,3 @@
+-- Короткий код уникален среди всех пользователей. Для таблиц, созданных до
+-- появления миграций без ограничения UNIQUE, индекс создается здесь.
+CREATE UNIQUE INDEX IF NOT EXISTS urls_short_url_key ON urls (short_url);
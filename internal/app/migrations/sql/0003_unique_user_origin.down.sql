@@ -0,0 +1 @@
+DROP INDEX IF EXISTS urls_user_id_origin_url_key;
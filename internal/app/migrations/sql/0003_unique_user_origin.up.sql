@@ -0,0 +1,5 @@
+-- Повторные сокращения одного URL, сохраненные до индекса, удаляются, остается первая ссылка.
+DELETE FROM urls a USING urls b
+WHERE a.user_id = b.user_id AND a.origin_url = b.origin_url AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS urls_user_id_origin_url_key ON urls (user_id, origin_url);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS delete_jobs (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT        NOT NULL,
+    items      TEXT[]      NOT NULL,
+    status     TEXT        NOT NULL,
+    total      INT         NOT NULL,
+    deleted    BIGINT      NOT NULL DEFAULT 0,
+    error      TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS delete_jobs_pending_idx ON delete_jobs (created_at) WHERE status IN ('queued', 'running');
@@ -0,0 +1,3 @@
+-- Ограничение заменяется уникальным индексом, как после 0002_unique_short_url.
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_short_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_short_url_key ON urls (short_url);
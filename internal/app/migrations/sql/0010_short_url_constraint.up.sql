@@ -0,0 +1,12 @@
+-- Уникальность короткого кода в таблицах, созданных до миграций, обеспечивал только индекс из
+-- 0002_unique_short_url. Здесь он становится ограничением, как в новой таблице из 0001_create_urls.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'urls_short_url_key' AND conrelid = 'urls'::regclass) THEN
+        IF EXISTS (SELECT 1 FROM pg_class WHERE relname = 'urls_short_url_key' AND relkind = 'i') THEN
+            ALTER TABLE urls ADD CONSTRAINT urls_short_url_key UNIQUE USING INDEX urls_short_url_key;
+        ELSE
+            ALTER TABLE urls ADD CONSTRAINT urls_short_url_key UNIQUE (short_url);
+        END IF;
+    END IF;
+END $$;
@@ -52,13 +52,13 @@ func (_m *RepoDBModel) BunchSave(_a0 context.Context, _a1 model.User, _a2 []mode
 	return r0, r1
 }
 
-// CheckExist provides a mock function with given fields: _a0, _a1
-func (_m *RepoDBModel) CheckExist(_a0 model.User, _a1 string) bool {
-	ret := _m.Called(_a0, _a1)
+// CheckExist provides a mock function with given fields: _a0
+func (_m *RepoDBModel) CheckExist(_a0 string) bool {
+	ret := _m.Called(_a0)
 
 	var r0 bool
-	if rf, ok := ret.Get(0).(func(model.User, string) bool); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(_a0)
 	} else {
 		r0 = ret.Get(0).(bool)
 	}
@@ -66,22 +66,64 @@ func (_m *RepoDBModel) CheckExist(_a0 model.User, _a1 string) bool {
 	return r0
 }
 
-// GetByUser provides a mock function with given fields: _a0, _a1
-func (_m *RepoDBModel) GetByUser(_a0 model.User, _a1 context.Context) (model.Links, error) {
+// GetByOrigin provides a mock function with given fields: _a0, _a1, _a2
+func (_m *RepoDBModel) GetByOrigin(_a0 model.User, _a1 string, _a2 context.Context) (string, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(model.User, string, context.Context) string); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.User, string, context.Context) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetByShort provides a mock function with given fields: _a0, _a1
+func (_m *RepoDBModel) GetByShort(_a0 string, _a1 context.Context) (model.Link, error) {
 	ret := _m.Called(_a0, _a1)
 
-	var r0 model.Links
-	if rf, ok := ret.Get(0).(func(model.User, context.Context) model.Links); ok {
+	var r0 model.Link
+	if rf, ok := ret.Get(0).(func(string, context.Context) model.Link); ok {
 		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(model.Link)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, context.Context) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetByUser provides a mock function with given fields: _a0, _a1, _a2
+func (_m *RepoDBModel) GetByUser(_a0 model.User, _a1 model.UserLinksQuery, _a2 context.Context) ([]model.Link, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 []model.Link
+	if rf, ok := ret.Get(0).(func(model.User, model.UserLinksQuery, context.Context) []model.Link); ok {
+		r0 = rf(_a0, _a1, _a2)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(model.Links)
+			r0 = ret.Get(0).([]model.Link)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(model.User, context.Context) error); ok {
-		r1 = rf(_a0, _a1)
+	if rf, ok := ret.Get(1).(func(model.User, model.UserLinksQuery, context.Context) error); ok {
+		r1 = rf(_a0, _a1, _a2)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -110,16 +152,65 @@ func (_m *RepoDBModel) GetItem(_a0 model.User, _a1 string, _a2 context.Context)
 	return r0, r1
 }
 
-// RemoveItems provides a mock function with given fields: _a0, _a1
-func (_m *RepoDBModel) RemoveItems(_a0 model.User, _a1 []int) error {
-	ret := _m.Called(_a0, _a1)
+// RemoveExpired provides a mock function with given fields: _a0
+func (_m *RepoDBModel) RemoveExpired(_a0 context.Context) (int64, error) {
+	ret := _m.Called(_a0)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(model.User, []int) error); ok {
-		r0 = rf(_a0, _a1)
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context) int64); ok {
+		r0 = rf(_a0)
 	} else {
-		r0 = ret.Error(0)
+		r0 = ret.Get(0).(int64)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RemoveItems provides a mock function with given fields: _a0, _a1, _a2
+func (_m *RepoDBModel) RemoveItems(_a0 context.Context, _a1 model.User, _a2 []string) (int64, error) {
+	ret := _m.Called(_a0, _a1, _a2)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, model.User, []string) int64); ok {
+		r0 = rf(_a0, _a1, _a2)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.User, []string) error); ok {
+		r1 = rf(_a0, _a1, _a2)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ServiceStats provides a mock function with given fields: _a0
+func (_m *RepoDBModel) ServiceStats(_a0 context.Context) (model.ServiceStats, error) {
+	ret := _m.Called(_a0)
+
+	var r0 model.ServiceStats
+	if rf, ok := ret.Get(0).(func(context.Context) model.ServiceStats); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Get(0).(model.ServiceStats)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(_a0)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
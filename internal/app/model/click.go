@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+type (
+	// Click переход по короткой ссылке.
+	Click struct {
+		Short     string
+		At        time.Time
+		Referrer  string
+		UserAgent string
+		// IPHash соленый хеш адреса клиента, сам адрес не хранится.
+		IPHash string
+	}
+	// ClickStats статистика переходов по короткой ссылке.
+	ClickStats struct {
+		Total  int64       `json:"total"`
+		Unique int64       `json:"unique_visitors"`
+		Daily  []DayClicks `json:"daily"`
+	}
+	// DayClicks число переходов за день UTC.
+	DayClicks struct {
+		Day    string `json:"day"`
+		Clicks int64  `json:"clicks"`
+	}
+)
+
+// DayLayout формат дня в гистограмме переходов.
+const DayLayout = "2006-01-02"
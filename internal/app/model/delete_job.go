@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Состояния задачи удаления.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// DeleteJob задача асинхронного удаления ссылок пользователя.
+// Items короткие коды или числовые id ссылок.
+type DeleteJob struct {
+	ID        string    `json:"id"`
+	User      User      `json:"-"`
+	Items     []string  `json:"-"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"`
+	Deleted   int64     `json:"deleted"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Pending задача еще не завершена и должна быть выполнена, в том числе после перезапуска.
+func (j DeleteJob) Pending() bool {
+	return j.Status == JobQueued || j.Status == JobRunning
+}
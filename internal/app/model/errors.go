@@ -0,0 +1,22 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound возвращается хранилищем, если ссылка не найдена.
+	ErrNotFound = errors.New("link not found")
+	// ErrCodeTaken возвращается, если короткий код уже занят другой ссылкой.
+	ErrCodeTaken = errors.New("short code is taken")
+	// ErrOriginExists возвращается, если пользователь уже сокращал этот URL.
+	ErrOriginExists = errors.New("original url already exists")
+	// ErrGone возвращается для удаленной или истекшей ссылки.
+	ErrGone = errors.New("link is gone")
+	// ErrDeleted и ErrExpired уточняют ErrGone.
+	ErrDeleted = fmt.Errorf("%w: deleted", ErrGone)
+	ErrExpired = fmt.Errorf("%w: expired", ErrGone)
+	// ErrBadExpiry возвращается при некорректном сроке действия ссылки.
+	ErrBadExpiry = errors.New("expires_at and ttl_seconds are mutually exclusive and must be in the future")
+)
@@ -1,31 +1,76 @@
 package model
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type (
 	Link struct {
 		ID      string `json:"correlation_id"`
 		URL     string `json:"original_url"`
 		Deleted bool   `json:"-"`
+		// RawURL адрес в том виде, в каком его прислал пользователь, URL его канонический вид.
+		RawURL string `json:"-"`
+		// Alias желаемый короткий код, пустой для сгенерированного.
+		Alias string `json:"alias,omitempty"`
+		// ExpiresAt момент, после которого ссылка перестает работать, nil для бессрочной.
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		// TTL время жизни в секундах, при создании пересчитывается в ExpiresAt.
+		TTL int64 `json:"ttl_seconds,omitempty"`
+		// Seq порядковый номер ссылки, аналог колонки id в таблице urls.
+		Seq int `json:"-"`
+		// Short короткий код, заполняется при выборке ссылок пользователя.
+		Short string `json:"-"`
+		// CreatedAt время создания, нулевое для ссылок, сохраненных до его появления.
+		CreatedAt time.Time `json:"-"`
 	}
 	ShortLink struct {
 		ID    string `json:"correlation_id"`
 		Short string `json:"original_url"`
+		// Err ошибка сохранения ссылки: ErrOriginExists, если URL был сохранен ранее
+		// и Short содержит прежний код, или ErrCodeTaken, если занят псевдоним.
+		Err error `json:"-"`
 	}
 	Links      map[string]Link
 	ShortLinks map[string]ShortLink
 	UserLink   struct {
-		ShortURL    string `json:"short_url"`
-		OriginalURL string `json:"original_url"`
+		ShortURL    string     `json:"short_url"`
+		OriginalURL string     `json:"original_url"`
+		RawURL      string     `json:"raw_url,omitempty"`
+		CreatedAt   *time.Time `json:"created_at,omitempty"`
+		Deleted     bool       `json:"deleted,omitempty"`
 	}
 )
 
+// Expired сообщает, истек ли срок действия ссылки к моменту now.
+func (l Link) Expired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// ResolveExpiry пересчитывает TTL в ExpiresAt относительно now и проверяет срок действия.
+func (l *Link) ResolveExpiry(now time.Time) error {
+	if l.TTL != 0 {
+		if l.ExpiresAt != nil || l.TTL < 0 {
+			return ErrBadExpiry
+		}
+		expiresAt := now.Add(time.Duration(l.TTL) * time.Second)
+		l.ExpiresAt = &expiresAt
+		l.TTL = 0
+	}
+	if l.ExpiresAt != nil && !l.ExpiresAt.After(now) {
+		return ErrBadExpiry
+	}
+	return nil
+}
+
 func (links Links) MarshalJSON() ([]byte, error) {
 	var linksPrepared []UserLink
 	for k, v := range links {
 		linksPrepared = append(linksPrepared, UserLink{
 			ShortURL:    k,
 			OriginalURL: v.URL,
+			RawURL:      v.RawURL,
 		})
 	}
 	return json.Marshal(linksPrepared)
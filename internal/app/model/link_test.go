@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLink_ResolveExpiry(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		link    Link
+		want    *time.Time
+		wantErr bool
+	}{
+		{name: "no expiry", link: Link{}},
+		{name: "ttl", link: Link{TTL: 3600}, want: &future},
+		{name: "expires at", link: Link{ExpiresAt: &future}, want: &future},
+		{name: "expires at in past", link: Link{ExpiresAt: &past}, wantErr: true},
+		{name: "negative ttl", link: Link{TTL: -1}, wantErr: true},
+		{name: "both", link: Link{TTL: 60, ExpiresAt: &future}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.link.ResolveExpiry(now)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBadExpiry)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tt.link.ExpiresAt)
+			assert.Zero(t, tt.link.TTL)
+		})
+	}
+}
+
+func TestLink_Expired(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Second)
+	future := now.Add(time.Second)
+	assert.False(t, Link{}.Expired(now))
+	assert.True(t, Link{ExpiresAt: &past}.Expired(now))
+	assert.True(t, Link{ExpiresAt: &now}.Expired(now))
+	assert.False(t, Link{ExpiresAt: &future}.Expired(now))
+}
@@ -0,0 +1,17 @@
+package model
+
+// ServiceStats сводная статистика сервиса.
+type ServiceStats struct {
+	URLs  int64 `json:"urls"`
+	Users int64 `json:"users"`
+	// Cache счетчики кеша редиректов, nil без кеша.
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// CacheStats счетчики кеша редиректов.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Size      int64 `json:"size"`
+}
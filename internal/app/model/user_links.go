@@ -0,0 +1,72 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBadCursor возвращается при разборе поврежденного курсора.
+var ErrBadCursor = errors.New("invalid cursor")
+
+// UserLinksQuery условия выборки ссылок пользователя. Ссылки упорядочены по времени создания,
+// при равенстве по Seq.
+type UserLinksQuery struct {
+	// Limit наибольшее число ссылок, 0 без ограничения.
+	Limit int
+	// After курсор последней полученной ссылки, nil для первой страницы.
+	After *Cursor
+	// Desc порядок от новых к старым.
+	Desc bool
+	// Contains подстрока оригинального URL без учета регистра.
+	Contains string
+	// IncludeDeleted включает удаленные ссылки.
+	IncludeDeleted bool
+}
+
+// Cursor позиция ссылки в списке пользователя.
+type Cursor struct {
+	CreatedAt time.Time
+	Seq       int
+}
+
+// CursorOf курсор, указывающий на ссылку.
+func CursorOf(link Link) Cursor {
+	return Cursor{CreatedAt: link.CreatedAt, Seq: link.Seq}
+}
+
+// String кодирует курсор в непрозрачную для клиента строку.
+func (c Cursor) String() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.Itoa(c.Seq)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Before сообщает, стоит ли позиция c раньше other при упорядочивании по возрастанию.
+func (c Cursor) Before(other Cursor) bool {
+	if !c.CreatedAt.Equal(other.CreatedAt) {
+		return c.CreatedAt.Before(other.CreatedAt)
+	}
+	return c.Seq < other.Seq
+}
+
+// ParseCursor разбирает курсор, полученный из Cursor.String.
+func ParseCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrBadCursor
+	}
+	at, seq, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrBadCursor
+	}
+	c := &Cursor{}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, at); err != nil {
+		return nil, ErrBadCursor
+	}
+	if c.Seq, err = strconv.Atoi(seq); err != nil {
+		return nil, ErrBadCursor
+	}
+	return c, nil
+}
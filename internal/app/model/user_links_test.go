@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCursor(t *testing.T) {
+	at := time.Date(2022, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	tests := []struct {
+		name    string
+		cursor  string
+		want    Cursor
+		wantErr bool
+	}{
+		{name: "round trip", cursor: Cursor{CreatedAt: at, Seq: 42}.String(), want: Cursor{CreatedAt: at, Seq: 42}},
+		{name: "legacy link", cursor: Cursor{Seq: 7}.String(), want: Cursor{Seq: 7}},
+		{name: "not base64", cursor: "~", wantErr: true},
+		{name: "no separator", cursor: base64.RawURLEncoding.EncodeToString([]byte("42")), wantErr: true},
+		{name: "bad time", cursor: base64.RawURLEncoding.EncodeToString([]byte("yesterday|42")), wantErr: true},
+		{name: "bad seq", cursor: base64.RawURLEncoding.EncodeToString([]byte("2022-03-01T12:00:00Z|x")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCursor(tt.cursor)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBadCursor)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.CreatedAt.Equal(got.CreatedAt))
+			assert.Equal(t, tt.want.Seq, got.Seq)
+		})
+	}
+}
+
+func TestCursor_Before(t *testing.T) {
+	at := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := Cursor{CreatedAt: at, Seq: 2}
+	assert.True(t, c.Before(Cursor{CreatedAt: at.Add(time.Second), Seq: 1}))
+	assert.True(t, c.Before(Cursor{CreatedAt: at, Seq: 3}))
+	assert.False(t, c.Before(c))
+	assert.False(t, c.Before(Cursor{CreatedAt: at, Seq: 1}))
+}
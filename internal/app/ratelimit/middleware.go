@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"ilyakasharokov/internal/app/httperror"
+	"ilyakasharokov/internal/app/middlewares"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Middleware ограничивает запросы scope отдельно для адреса клиента и пользователя из Cookie,
+// запрос проходит и расходует токены, только если разрешили обе корзины. Адрес берется из RealIP,
+// X-Real-IP учитывается только от доверенных прокси.
+// Ответ содержит X-RateLimit-Limit, X-RateLimit-Remaining и X-RateLimit-Reset по более строгой корзине,
+// отклоненный запрос получает 429 и Retry-After. При ошибке хранилища запрос пропускается.
+func Middleware(store Store, scope string, limit Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !limit.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys := []string{scope + ":ip:" + middlewares.RealIP(r).String()}
+			if userID, ok := r.Context().Value(middlewares.UserIDCtxName).(string); ok && userID != "" {
+				keys = append(keys, scope+":user:"+userID)
+			}
+			result, err := store.Take(r.Context(), keys, limit, time.Now())
+			if err != nil {
+				zerolog.Ctx(r.Context()).Err(err).Strs("keys", keys).Msg("Rate limit error")
+				next.ServeHTTP(w, r)
+				return
+			}
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			h.Set("X-RateLimit-Reset", ceilSeconds(result.Reset))
+			if !result.Allowed {
+				h.Set("Retry-After", ceilSeconds(result.RetryAfter))
+				httperror.Write(w, r, httperror.New(http.StatusTooManyRequests, httperror.CodeTooManyRequests, "Too many requests"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
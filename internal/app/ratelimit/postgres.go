@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Postgres хранит корзины в таблице rate_limits, общей для всех экземпляров сервиса.
+// Корзина блокируется на время транзакции, поэтому параллельные запросы не берут один токен дважды.
+type Postgres struct {
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Take берет токены из корзин keys в одной транзакции. Новые корзины создаются полными.
+func (p *Postgres) Take(ctx context.Context, keys []string, limit Limit, now time.Time) (result Result, err error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	_, err = tx.ExecContext(ctx, `
+		insert into rate_limits (key, tokens, updated_at) select unnest($1::text[]), $2, $3
+		on conflict (key) do nothing
+	`, pq.Array(keys), float64(limit.Burst), now)
+	if err != nil {
+		return Result{}, err
+	}
+	// строки блокируются в порядке ключей, чтобы параллельные запросы не ждали друг друга по кругу
+	rows, err := tx.QueryContext(ctx, `
+		select key, tokens, updated_at from rate_limits where key = any($1) order by key for update
+	`, pq.Array(keys))
+	if err != nil {
+		return Result{}, err
+	}
+	var (
+		names   []string
+		buckets []*bucket
+	)
+	for rows.Next() {
+		var key string
+		b := &bucket{}
+		if err = rows.Scan(&key, &b.tokens, &b.updated); err != nil {
+			rows.Close()
+			return Result{}, err
+		}
+		names = append(names, key)
+		buckets = append(buckets, b)
+	}
+	if err = rows.Err(); err != nil {
+		return Result{}, err
+	}
+	result = takeAll(buckets, limit, now)
+	for i, b := range buckets {
+		_, err = tx.ExecContext(ctx, `
+			update rate_limits set tokens=$2, updated_at=$3 where key=$1
+		`, names[i], b.tokens, b.updated)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	return result, tx.Commit()
+}
+
+// Sweep удаляет корзины, не использовавшиеся дольше idle. Такие корзины уже полные.
+func (p *Postgres) Sweep(ctx context.Context, idle time.Duration) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `
+		delete from rate_limits where updated_at < $1
+	`, time.Now().Add(-idle))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,146 @@
+// Ограничение частоты запросов по алгоритму token bucket.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit пополнение корзины Rate токенов в секунду до Burst токенов.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Enabled сообщает, задано ли ограничение.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// FillTime время, за которое пустая корзина заполняется полностью, 0 без ограничения.
+func (l Limit) FillTime() time.Duration {
+	if !l.Enabled() {
+		return 0
+	}
+	return seconds(float64(l.Burst) / l.Rate)
+}
+
+// Result результат попытки взять токены. Для нескольких корзин Remaining берется по самой пустой,
+// RetryAfter и Reset по самой долгой.
+type Result struct {
+	Allowed bool
+	// Remaining целых токенов осталось в корзине.
+	Remaining int
+	// RetryAfter через сколько появится следующий токен, если запрос отклонен.
+	RetryAfter time.Duration
+	// Reset через сколько корзина заполнится полностью.
+	Reset time.Duration
+}
+
+// Store хранилище корзин.
+type Store interface {
+	// Take берет по токену из каждой корзины keys, только если токен есть во всех.
+	// Отклоненный запрос не расходует токены ни одной корзины.
+	Take(ctx context.Context, keys []string, limit Limit, now time.Time) (Result, error)
+}
+
+// bucket корзина токенов на момент updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill пополняет корзину к моменту now.
+func (b *bucket) refill(limit Limit, now time.Time) {
+	// часы экземпляров могут расходиться, время корзины не идет назад
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+		b.updated = now
+	}
+}
+
+// takeAll пополняет корзины к моменту now и берет по токену из каждой, если токен есть во всех.
+func takeAll(buckets []*bucket, limit Limit, now time.Time) Result {
+	result := Result{Allowed: true, Remaining: limit.Burst}
+	for _, b := range buckets {
+		b.refill(limit, now)
+		if b.tokens < 1 {
+			result.Allowed = false
+		}
+	}
+	for _, b := range buckets {
+		if result.Allowed {
+			b.tokens--
+		} else if b.tokens < 1 {
+			if retry := seconds((1 - b.tokens) / limit.Rate); retry > result.RetryAfter {
+				result.RetryAfter = retry
+			}
+		}
+		if remaining := int(b.tokens); remaining < result.Remaining {
+			result.Remaining = remaining
+		}
+		if reset := seconds((float64(limit.Burst) - b.tokens) / limit.Rate); reset > result.Reset {
+			result.Reset = reset
+		}
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// full сообщает, заполнится ли корзина к моменту now, такую можно забыть.
+func (b *bucket) full(limit Limit, now time.Time) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*limit.Rate >= float64(limit.Burst)
+}
+
+// sweepInterval период удаления заполненных корзин из памяти.
+const sweepInterval = time.Minute
+
+// Memory хранит корзины в памяти процесса.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*memoryBucket)}
+}
+
+// Take берет токены из корзин keys. Новые корзины создаются полными.
+func (m *Memory) Take(_ context.Context, keys []string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+	buckets := make([]*bucket, len(keys))
+	for i, key := range keys {
+		b, ok := m.buckets[key]
+		if !ok {
+			b = &memoryBucket{bucket: bucket{tokens: float64(limit.Burst), updated: now}}
+			m.buckets[key] = b
+		}
+		b.limit = limit
+		buckets[i] = &b.bucket
+	}
+	return takeAll(buckets, limit, now), nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if b.full(b.limit, now) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ilyakasharokov/internal/app/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_Take(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	limit := Limit{Rate: 2, Burst: 3}
+	now := time.Now()
+
+	for i := 2; i >= 0; i-- {
+		result, err := m.Take(ctx, []string{"k"}, limit, now)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, i, result.Remaining)
+	}
+	result, _ := m.Take(ctx, []string{"k"}, limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, result.Reset)
+
+	// другая корзина не затронута
+	result, _ = m.Take(ctx, []string{"other"}, limit, now)
+	assert.True(t, result.Allowed)
+
+	// за полсекунды появился один токен
+	result, _ = m.Take(ctx, []string{"k"}, limit, now.Add(500*time.Millisecond))
+	assert.True(t, result.Allowed)
+	result, _ = m.Take(ctx, []string{"k"}, limit, now.Add(500*time.Millisecond))
+	assert.False(t, result.Allowed)
+
+	// корзина не переполняется
+	result, _ = m.Take(ctx, []string{"k"}, limit, now.Add(time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestMemory_TakeAll(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	limit := Limit{Rate: 1, Burst: 2}
+	now := time.Now()
+
+	_, _ = m.Take(ctx, []string{"user"}, limit, now)
+	_, _ = m.Take(ctx, []string{"user"}, limit, now)
+	// пустая корзина пользователя отклоняет запрос и не расходует токены адреса
+	for i := 0; i < 3; i++ {
+		result, err := m.Take(ctx, []string{"ip", "user"}, limit, now)
+		require.NoError(t, err)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, time.Second, result.RetryAfter)
+	}
+	result, _ := m.Take(ctx, []string{"ip"}, limit, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	// разрешенный запрос берет токен из каждой корзины, остаток по самой пустой
+	result, _ = m.Take(ctx, []string{"ip", "fresh"}, limit, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 2*time.Second, result.Reset)
+	result, _ = m.Take(ctx, []string{"fresh"}, limit, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	limit := Limit{Rate: 1, Burst: 10}
+	now := time.Now()
+	_, _ = m.Take(ctx, []string{"idle"}, limit, now)
+	_, _ = m.Take(ctx, []string{"busy"}, limit, now)
+	for i := 0; i < 9; i++ {
+		_, _ = m.Take(ctx, []string{"busy"}, limit, now.Add(sweepInterval-time.Second))
+	}
+	_, _ = m.Take(ctx, []string{"trigger"}, limit, now.Add(sweepInterval))
+	assert.NotContains(t, m.buckets, "idle")
+	assert.Contains(t, m.buckets, "busy")
+}
+
+func TestLimit_FillTime(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Limit{Rate: 2, Burst: 20}.FillTime())
+	assert.Zero(t, Limit{}.FillTime())
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, []string, Limit, time.Time) (Result, error) {
+	return Result{}, errors.New("db is down")
+}
+
+func TestMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := func(ip string, user string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		if user != "" {
+			r = r.WithContext(context.WithValue(r.Context(), middlewares.UserIDCtxName, user))
+		}
+		return r
+	}
+	limit := Limit{Rate: 0.001, Burst: 2}
+
+	t.Run("per user and per ip", func(t *testing.T) {
+		h := Middleware(NewMemory(), "create", limit)(ok)
+		codes := []int{}
+		for _, r := range []*http.Request{
+			request("10.0.0.1", "alice"),
+			request("10.0.0.2", "alice"),
+			// третий запрос alice с нового адреса
+			request("10.0.0.3", "alice"),
+			// новые пользователи с одного адреса
+			request("10.0.0.4", "u1"),
+			request("10.0.0.4", "u2"),
+			request("10.0.0.4", "u3"),
+		} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			codes = append(codes, w.Code)
+		}
+		assert.Equal(t, []int{200, 200, 429, 200, 200, 429}, codes)
+	})
+
+	t.Run("rotating X-Real-IP without cookie", func(t *testing.T) {
+		proxies, _ := middlewares.ParseProxies("10.1.0.0/16")
+		h := middlewares.TrustedProxies(proxies)(Middleware(NewMemory(), "create", limit)(ok))
+		codes := []int{}
+		for i := 0; i < 3; i++ {
+			r := request("10.0.0.5", "")
+			r.Header.Set("X-Real-IP", fmt.Sprintf("203.0.113.%d", i))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			codes = append(codes, w.Code)
+		}
+		assert.Equal(t, []int{200, 200, 429}, codes)
+	})
+
+	t.Run("X-Real-IP from trusted proxy", func(t *testing.T) {
+		proxies, _ := middlewares.ParseProxies("10.1.0.0/16")
+		h := middlewares.TrustedProxies(proxies)(Middleware(NewMemory(), "create", limit)(ok))
+		for i := 0; i < 3; i++ {
+			r := request("10.1.0.1", "")
+			r.Header.Set("X-Real-IP", fmt.Sprintf("203.0.113.%d", i))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+	})
+
+	t.Run("rejected user does not drain ip", func(t *testing.T) {
+		h := Middleware(NewMemory(), "create", limit)(ok)
+		codes := []int{}
+		for _, r := range []*http.Request{
+			request("10.0.0.8", "greedy"),
+			request("10.0.0.8", "greedy"),
+			// отклоненные запросы не расходуют запас адреса
+			request("10.0.0.9", "greedy"),
+			request("10.0.0.9", "greedy"),
+			request("10.0.0.9", "neighbour"),
+			request("10.0.0.9", "neighbour"),
+		} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			codes = append(codes, w.Code)
+		}
+		assert.Equal(t, []int{200, 200, 429, 429, 200, 200}, codes)
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		h := Middleware(NewMemory(), "create", limit)(ok)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request("10.0.0.1", "bob"))
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, "1000", w.Header().Get("X-RateLimit-Reset"))
+		assert.Empty(t, w.Header().Get("Retry-After"))
+
+		h.ServeHTTP(httptest.NewRecorder(), request("10.0.0.1", "bob"))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, request("10.0.0.1", "bob"))
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, "1000", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := Middleware(NewMemory(), "create", Limit{})(ok)
+		for i := 0; i < 5; i++ {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request("10.0.0.1", "carol"))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+		}
+	})
+
+	t.Run("store error lets request through", func(t *testing.T) {
+		h := Middleware(failingStore{}, "create", limit)(ok)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request("10.0.0.1", "dave"))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
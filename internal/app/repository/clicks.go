@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"ilyakasharokov/internal/app/model"
+	"sort"
+	"sync"
+)
+
+// clicks переходы по коротким кодам, пишутся из воркеров параллельно с чтением статистики.
+type clicks struct {
+	mu      sync.RWMutex
+	byShort map[string][]model.Click
+}
+
+// Сохранение пакета переходов.
+func (repo *Repository) SaveClicks(_ context.Context, batch []model.Click) error {
+	repo.clicks.mu.Lock()
+	defer repo.clicks.mu.Unlock()
+	if repo.clicks.byShort == nil {
+		repo.clicks.byShort = make(map[string][]model.Click)
+	}
+	for _, c := range batch {
+		repo.clicks.byShort[c.Short] = append(repo.clicks.byShort[c.Short], c)
+	}
+	return nil
+}
+
+// Статистика переходов по короткому коду: всего, уникальные посетители и гистограмма по дням UTC.
+func (repo *Repository) ClickStats(_ context.Context, short string) (model.ClickStats, error) {
+	repo.clicks.mu.RLock()
+	defer repo.clicks.mu.RUnlock()
+	stats := model.ClickStats{Daily: []model.DayClicks{}}
+	visitors := make(map[string]bool)
+	days := make(map[string]int64)
+	for _, c := range repo.clicks.byShort[short] {
+		stats.Total++
+		visitors[c.IPHash] = true
+		days[c.At.UTC().Format(model.DayLayout)]++
+	}
+	stats.Unique = int64(len(visitors))
+	for day, count := range days {
+		stats.Daily = append(stats.Daily, model.DayClicks{Day: day, Clicks: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Day < stats.Daily[j].Day
+	})
+	return stats, nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"ilyakasharokov/internal/app/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobs задачи удаления. При заданном пути каждое изменение сразу сохраняется в фаил,
+// чтобы незавершенные задачи пережили перезапуск.
+type jobs struct {
+	mu   sync.Mutex
+	path string
+	byID map[string]jobRecord
+}
+
+// jobRecord задача удаления в фаиле, в отличие от API хранит пользователя и коды.
+type jobRecord struct {
+	model.DeleteJob
+	User  model.User `json:"user"`
+	Items []string   `json:"items"`
+}
+
+func jobsPath(fileStoragePath string) string {
+	if fileStoragePath == "" {
+		return ""
+	}
+	return fileStoragePath + ".jobs"
+}
+
+func (j *jobs) load(path string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.path = path
+	j.byID = make(map[string]jobRecord)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &j.byID)
+}
+
+// save пишет задачи во временный фаил и подменяет им прежний так же, как writeSnapshot.
+func (j *jobs) save() error {
+	if j.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(j.byID)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(j.path))
+}
+
+func (j *jobs) put(job model.DeleteJob) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.byID == nil {
+		j.byID = make(map[string]jobRecord)
+	}
+	j.byID[job.ID] = jobRecord{DeleteJob: job, User: job.User, Items: job.Items}
+	return j.save()
+}
+
+// Сохранение новой задачи удаления.
+func (repo *Repository) CreateDeleteJob(_ context.Context, job model.DeleteJob) error {
+	return repo.jobs.put(job)
+}
+
+// Обновление состояния задачи удаления.
+func (repo *Repository) UpdateDeleteJob(_ context.Context, job model.DeleteJob) error {
+	return repo.jobs.put(job)
+}
+
+// Получение задачи удаления пользователя.
+func (repo *Repository) GetDeleteJob(_ context.Context, user model.User, id string) (model.DeleteJob, error) {
+	repo.jobs.mu.Lock()
+	defer repo.jobs.mu.Unlock()
+	rec, ok := repo.jobs.byID[id]
+	if !ok || rec.User != user {
+		return model.DeleteJob{}, model.ErrNotFound
+	}
+	return rec.job(), nil
+}
+
+// Незавершенные задачи удаления в порядке создания.
+func (repo *Repository) PendingDeleteJobs(_ context.Context) ([]model.DeleteJob, error) {
+	repo.jobs.mu.Lock()
+	defer repo.jobs.mu.Unlock()
+	var pending []model.DeleteJob
+	for _, rec := range repo.jobs.byID {
+		if rec.Pending() {
+			pending = append(pending, rec.job())
+		}
+	}
+	sort.Slice(pending, func(i, k int) bool {
+		return pending[i].CreatedAt.Before(pending[k].CreatedAt)
+	})
+	return pending, nil
+}
+
+// Возврат завершившихся ошибкой задач удаления в очередь.
+func (repo *Repository) RetryFailedDeleteJobs(_ context.Context) (int64, error) {
+	repo.jobs.mu.Lock()
+	defer repo.jobs.mu.Unlock()
+	var n int64
+	now := time.Now().UTC()
+	for id, rec := range repo.jobs.byID {
+		if rec.Status != model.JobFailed {
+			continue
+		}
+		rec.Status = model.JobQueued
+		rec.Error = ""
+		rec.UpdatedAt = now
+		repo.jobs.byID[id] = rec
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, repo.jobs.save()
+}
+
+func (rec jobRecord) job() model.DeleteJob {
+	job := rec.DeleteJob
+	job.User = rec.User
+	job.Items = rec.Items
+	return job
+}
@@ -1,130 +1,389 @@
-// Репозиторий с хранением в памяти и в фаиле
+// Репозиторий с хранением в памяти и в фаиле: снимок и журнал изменений в формате JSON lines
 package repository
 
 import (
-	"bufio"
-	"encoding/gob"
+	"context"
 	"errors"
-	"fmt"
 	"ilyakasharokov/internal/app/model"
-	"io"
-	"log"
-	"os"
+	"ilyakasharokov/internal/app/shortcode"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
+// Repository безопасен для одновременного использования. Ссылки разбиты на сегменты по пользователям,
+// индекс коротких кодов и журнал защищены своими блокировками. Блокировки берутся в порядке
+// сегмент, индекс кодов, журнал.
 type Repository struct {
-	db              map[model.User]model.Links
+	shards []*shard
+	// owners индекс владельцев коротких кодов, коды уникальны среди всех пользователей.
+	ownersMu        sync.RWMutex
+	owners          map[string]model.User
 	fileStoragePath string
+	seq             int64
+	codes           *shortcode.Allocator
+	clicks          clicks
+	jobs            jobs
+	// log журнал изменений, nil при хранении только в памяти.
+	log *wal
+}
+
+// Добавление URL в память.
+func (repo *Repository) AddItem(user model.User, key string, link model.Link, _ context.Context) error {
+	s := repo.shard(user)
+	s.mu.Lock()
+	if repo.CheckExist(key) {
+		s.mu.Unlock()
+		return model.ErrCodeTaken
+	}
+	if _, ok := s.byOrigin(user, link.URL); ok {
+		s.mu.Unlock()
+		return model.ErrOriginExists
+	}
+	if !repo.reserve(key, user) {
+		s.mu.Unlock()
+		return model.ErrCodeTaken
+	}
+	link.Seq = int(atomic.AddInt64(&repo.seq, 1))
+	link.CreatedAt = time.Now().UTC()
+	rec := addRecord(user, key, link)
+	if err := repo.log.append(rec); err != nil {
+		repo.release(key)
+		s.mu.Unlock()
+		return err
+	}
+	s.apply(rec)
+	s.mu.Unlock()
+	repo.compactIfFull()
+	return nil
 }
 
-type producer struct {
-	file   *os.File
-	writer *bufio.Writer
+// reserve занимает короткий код за пользователем, если он свободен.
+func (repo *Repository) reserve(key string, user model.User) bool {
+	repo.ownersMu.Lock()
+	defer repo.ownersMu.Unlock()
+	if _, ok := repo.owners[key]; ok {
+		return false
+	}
+	repo.owners[key] = user
+	return true
 }
 
-type consumer struct {
-	file    *os.File
-	scanner *bufio.Scanner
+func (repo *Repository) release(key string) {
+	repo.ownersMu.Lock()
+	defer repo.ownersMu.Unlock()
+	delete(repo.owners, key)
 }
 
-func newProducer(fileName string) (*producer, error) {
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE, 0777)
-	if err != nil {
-		return nil, err
+// Получение URL по ключу.
+func (repo *Repository) GetItem(user model.User, key string, _ context.Context) (model.Link, error) {
+	s := repo.shard(user)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	link, ok := s.db[user][key]
+	if !ok {
+		return model.Link{}, model.ErrNotFound
 	}
+	return link, nil
+}
 
-	return &producer{
-		file:   file,
-		writer: bufio.NewWriter(file),
-	}, nil
+// Получение URL пользователя по условиям q, упорядоченных по времени создания.
+func (repo *Repository) GetByUser(user model.User, q model.UserLinksQuery, _ context.Context) ([]model.Link, error) {
+	s := repo.shard(user)
+	s.mu.RLock()
+	result := make([]model.Link, 0, len(s.db[user]))
+	contains := strings.ToLower(q.Contains)
+	for key, link := range s.db[user] {
+		if link.Deleted && !q.IncludeDeleted {
+			continue
+		}
+		if contains != "" && !strings.Contains(strings.ToLower(link.URL), contains) {
+			continue
+		}
+		link.Short = key
+		result = append(result, link)
+	}
+	s.mu.RUnlock()
+	// less сравнивает позиции в выбранном порядке
+	less := func(a, b model.Cursor) bool {
+		if q.Desc {
+			return b.Before(a)
+		}
+		return a.Before(b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return less(model.CursorOf(result[i]), model.CursorOf(result[j]))
+	})
+	if q.After != nil {
+		i := sort.Search(len(result), func(i int) bool {
+			return less(*q.After, model.CursorOf(result[i]))
+		})
+		result = result[i:]
+	}
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+	return result, nil
 }
 
-func newConsumer(fileName string) (*consumer, error) {
-	f, err := os.OpenFile(fileName, os.O_RDONLY|os.O_CREATE, 0777)
-	if err != nil {
-		return nil, err
+// Число сокращенных URL и пользователей.
+func (repo *Repository) ServiceStats(_ context.Context) (model.ServiceStats, error) {
+	repo.ownersMu.RLock()
+	stats := model.ServiceStats{URLs: int64(len(repo.owners))}
+	repo.ownersMu.RUnlock()
+	for _, s := range repo.shards {
+		s.mu.RLock()
+		for _, links := range s.db {
+			if len(links) > 0 {
+				stats.Users++
+			}
+		}
+		s.mu.RUnlock()
 	}
+	return stats, nil
+}
 
-	return &consumer{
-		file: f,
-	}, nil
+// Получение URL по короткому коду без учета пользователя.
+func (repo *Repository) GetByShort(key string, ctx context.Context) (model.Link, error) {
+	repo.ownersMu.RLock()
+	owner, ok := repo.owners[key]
+	repo.ownersMu.RUnlock()
+	if !ok {
+		return model.Link{}, model.ErrNotFound
+	}
+	return repo.GetItem(owner, key, ctx)
 }
 
-func (repo *Repository) AddItem(user model.User, key string, link model.Link) error {
-	links := model.Links{}
-	if userLinks, ok := repo.db[user]; ok {
-		links = userLinks
+// Получение короткого кода, под которым пользователь ранее сохранил оригинальный URL.
+func (repo *Repository) GetByOrigin(user model.User, origin string, _ context.Context) (string, error) {
+	s := repo.shard(user)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.byOrigin(user, origin); ok {
+		return key, nil
 	}
-	links[key] = link
-	repo.db[user] = links
-	return nil
+	return "", model.ErrNotFound
 }
 
-func (repo *Repository) GetItem(user model.User, key string) (model.Link, error) {
-	return repo.db[user][key], nil
+// Проверка, занят ли короткий код любым пользователем.
+func (repo *Repository) CheckExist(key string) bool {
+	repo.ownersMu.RLock()
+	defer repo.ownersMu.RUnlock()
+	_, result := repo.owners[key]
+	return result
 }
 
-func (repo *Repository) GetByUser(user model.User) (model.Links, error) {
-	links, ok := repo.db[user]
-	if !ok {
-		return links, errors.New("user not found")
+// Сохранение множества URL.
+func (repo *Repository) BunchSave(ctx context.Context, user model.User, links []model.Link) ([]model.ShortLink, error) {
+	var shorts []model.ShortLink
+	for _, v := range links {
+		if short, err := repo.GetByOrigin(user, v.URL, ctx); err == nil {
+			shorts = append(shorts, model.ShortLink{
+				ID:    v.ID,
+				Short: short,
+				Err:   model.ErrOriginExists,
+			})
+			continue
+		}
+		short := v.Alias
+		if short == "" {
+			var err error
+			short, err = repo.codes.Allocate(v.URL, repo.CheckExist)
+			if err != nil {
+				return shorts, err
+			}
+		}
+		// код или URL могли занять параллельно, AddItem проверяет это под блокировкой
+		err := repo.AddItem(user, short, model.Link{ID: v.ID, URL: v.URL, RawURL: v.RawURL, ExpiresAt: v.ExpiresAt}, ctx)
+		switch {
+		case errors.Is(err, model.ErrCodeTaken):
+			shorts = append(shorts, model.ShortLink{
+				ID:  v.ID,
+				Err: model.ErrCodeTaken,
+			})
+			continue
+		case errors.Is(err, model.ErrOriginExists):
+			short, _ = repo.GetByOrigin(user, v.URL, ctx)
+			shorts = append(shorts, model.ShortLink{
+				ID:    v.ID,
+				Short: short,
+				Err:   model.ErrOriginExists,
+			})
+			continue
+		case err != nil:
+			return shorts, err
+		}
+		shorts = append(shorts, model.ShortLink{
+			ID:    v.ID,
+			Short: short,
+		})
 	}
-	return links, nil
+	return shorts, nil
 }
 
-func (repo *Repository) CheckExist(user model.User, key string) bool {
-	links, ok := repo.db[user]
-	if !ok {
-		return false
+// Пометка удаленными всех ссылок с истекшим сроком действия.
+func (repo *Repository) RemoveExpired(_ context.Context) (int64, error) {
+	var removed int64
+	now := time.Now()
+	for _, s := range repo.shards {
+		n, err := repo.remove(s, func() []record {
+			var recs []record
+			for user, links := range s.db {
+				for key, link := range links {
+					if !link.Deleted && link.Expired(now) {
+						recs = append(recs, record{Op: opDelete, User: user, Key: key})
+					}
+				}
+			}
+			return recs
+		})
+		removed += n
+		if err != nil {
+			return removed, err
+		}
 	}
-	_, result := links[key]
-	return result
+	return removed, nil
+}
+
+// Пометка удаленными ссылок пользователя по коротким кодам или числовым id.
+func (repo *Repository) RemoveItems(_ context.Context, user model.User, items []string) (int64, error) {
+	remove := make(map[string]bool, len(items))
+	for _, item := range items {
+		remove[item] = true
+	}
+	s := repo.shard(user)
+	return repo.remove(s, func() []record {
+		var recs []record
+		for key, link := range s.db[user] {
+			if !link.Deleted && (remove[key] || remove[strconv.Itoa(link.Seq)]) {
+				recs = append(recs, record{Op: opDelete, User: user, Key: key})
+			}
+		}
+		return recs
+	})
+}
+
+// remove помечает удаленными ссылки сегмента, выбранные collect под блокировкой сегмента.
+// Удаления сначала записываются в журнал, затем применяются в памяти.
+func (repo *Repository) remove(s *shard, collect func() []record) (int64, error) {
+	s.mu.Lock()
+	recs := collect()
+	if err := repo.log.append(recs...); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	for _, rec := range recs {
+		s.apply(rec)
+	}
+	s.mu.Unlock()
+	repo.compactIfFull()
+	return int64(len(recs)), nil
+}
+
+// compactIfFull сворачивает журнал, когда в нем накопилось CompactEvery записей.
+// Изменение уже записано в журнал, поэтому ошибка свертки только логируется.
+func (repo *Repository) compactIfFull() {
+	if !repo.log.full() {
+		return
+	}
+	if err := repo.compact(); err != nil {
+		log.Err(err).Msg("Compact log error")
+	}
+}
+
+// New создает репозиторий с журналом по умолчанию. Если журнал не открылся,
+// репозиторий продолжает работу только в памяти.
+func New(fileStoragePath string, codes *shortcode.Allocator) *Repository {
+	repo := newRepository(fileStoragePath, codes)
+	if err := repo.open(DefaultOptions); err != nil {
+		log.Err(err).Msg("Open storage log error")
+	}
+	return repo
+}
+
+// Open создает репозиторий, восстанавливает данные из снимка и журнала
+// и сворачивает журнал в новый снимок.
+func Open(fileStoragePath string, codes *shortcode.Allocator, opts Options) (*Repository, error) {
+	repo := newRepository(fileStoragePath, codes)
+	if err := repo.open(opts); err != nil {
+		return nil, err
+	}
+	return repo, nil
 }
 
-func New(fileStoragePath string) *Repository {
-	db := make(map[model.User]model.Links)
-	repo := Repository{
-		db:              db,
+func newRepository(fileStoragePath string, codes *shortcode.Allocator) *Repository {
+	repo := &Repository{
+		shards:          newShards(shardCount),
+		owners:          make(map[string]model.User),
 		fileStoragePath: fileStoragePath,
+		codes:           codes,
 	}
-	repo.load()
-	return &repo
+	if err := repo.jobs.load(jobsPath(fileStoragePath)); err != nil {
+		log.Err(err).Msg("Load delete jobs error")
+	}
+	return repo
 }
 
-func (repo *Repository) Flush() error {
+func (repo *Repository) open(opts Options) error {
 	if repo.fileStoragePath == "" {
 		return nil
 	}
-	// Create new producer for write links to file storage
-	p, err := newProducer(repo.fileStoragePath)
-	if nil != err {
+	if err := opts.validate(); err != nil {
 		return err
 	}
-	// Convert to gob
-	gobEncoder := gob.NewEncoder(p.writer)
-	// encode
-	if err := gobEncoder.Encode(repo.db); err != nil {
+	if err := repo.load(); err != nil {
 		return err
 	}
-	fmt.Println("flush")
-	return p.writer.Flush()
+	log, err := openLog(walPath(repo.fileStoragePath), opts)
+	if err != nil {
+		return err
+	}
+	repo.log = log
+	return repo.compact()
+}
+
+// Flush сворачивает журнал в снимок.
+func (repo *Repository) Flush() error {
+	return repo.compact()
+}
+
+// Close сворачивает журнал в снимок и закрывает его.
+func (repo *Repository) Close() error {
+	if repo.log == nil {
+		return nil
+	}
+	err := repo.compact()
+	if cerr := repo.log.close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
-// Load all links to map
+// load восстанавливает ссылки из снимка и журнала.
 func (repo *Repository) load() error {
 	if repo.fileStoragePath == "" {
 		return nil
 	}
-	cns, err := newConsumer(repo.fileStoragePath)
-	if nil != err {
+	if err := repo.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := repo.replay(walPath(repo.fileStoragePath)); err != nil {
 		return err
 	}
-	gobDecoder := gob.NewDecoder(cns.file)
-	if err := gobDecoder.Decode(&repo.db); err != nil {
-		if err != io.EOF {
-			return err
+	for _, s := range repo.shards {
+		for user, links := range s.db {
+			for key, link := range links {
+				repo.owners[key] = user
+				if int64(link.Seq) > repo.seq {
+					repo.seq = int64(link.Seq)
+				}
+			}
 		}
 	}
-	log.Println(repo.db)
 	return nil
 }
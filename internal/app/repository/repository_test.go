@@ -1,17 +1,25 @@
 package repository
 
 import (
+	"context"
 	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/shortcode"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const testUser = model.User("default")
 const testURL = "https://yandex.ru"
 const testCode = "1692759882237307797"
 
+var testCodes = shortcode.NewAllocator(shortcode.NewHash(8), 3)
+
 func TestRepository_AddItem(t *testing.T) {
 	type fields struct {
-		db              map[model.User]model.Links
 		fileStoragePath string
 	}
 	type args struct {
@@ -36,12 +44,8 @@ func TestRepository_AddItem(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo := &Repository{
-				db:              tt.fields.db,
-				fileStoragePath: tt.fields.fileStoragePath,
-			}
-			repo.db = make(map[model.User]model.Links)
-			if err := repo.AddItem(tt.args.user, tt.args.key, tt.args.link); (err != nil) != tt.wantErr {
+			repo := newRepository(tt.fields.fileStoragePath, testCodes)
+			if err := repo.AddItem(tt.args.user, tt.args.key, tt.args.link, context.Background()); (err != nil) != tt.wantErr {
 				t.Errorf("AddItem() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -50,12 +54,10 @@ func TestRepository_AddItem(t *testing.T) {
 
 func TestRepository_CheckExist(t *testing.T) {
 	type fields struct {
-		db              map[model.User]model.Links
 		fileStoragePath string
 	}
 	type args struct {
-		user model.User
-		key  string
+		key string
 	}
 	tests := []struct {
 		name   string
@@ -66,8 +68,7 @@ func TestRepository_CheckExist(t *testing.T) {
 		{
 			name: "good payload",
 			args: args{
-				user: testUser,
-				key:  testCode,
+				key: testCode,
 			},
 			want: true,
 		},
@@ -75,22 +76,188 @@ func TestRepository_CheckExist(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo := &Repository{
-				db:              tt.fields.db,
-				fileStoragePath: tt.fields.fileStoragePath,
-			}
-			repo.db = make(map[model.User]model.Links)
-			repo.AddItem(testUser, testCode, model.Link{URL: testURL})
-			if got := repo.CheckExist(tt.args.user, tt.args.key); got != tt.want {
+			repo := newRepository(tt.fields.fileStoragePath, testCodes)
+			repo.AddItem(testUser, testCode, model.Link{URL: testURL}, context.Background())
+			if got := repo.CheckExist(tt.args.key); got != tt.want {
 				t.Errorf("CheckExist() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestRepository_GetItem(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	repo.AddItem(testUser, testCode, model.Link{URL: testURL}, ctx)
+
+	link, err := repo.GetItem(testUser, testCode, ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testURL, link.URL)
+
+	_, err = repo.GetItem(testUser, "unknown", ctx)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestRepository_GetByShort(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	repo.AddItem(testUser, testCode, model.Link{URL: testURL}, ctx)
+
+	link, err := repo.GetByShort(testCode, ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testURL, link.URL)
+
+	_, err = repo.GetByShort("unknown", ctx)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	err = repo.AddItem(model.User("other"), testCode, model.Link{URL: testURL + "/other"}, ctx)
+	assert.ErrorIs(t, err, model.ErrCodeTaken)
+}
+
+// userLinks все ссылки пользователя, включая удаленные, по коротким кодам.
+func userLinks(t *testing.T, repo *Repository, user model.User) model.Links {
+	t.Helper()
+	list, err := repo.GetByUser(user, model.UserLinksQuery{IncludeDeleted: true}, context.Background())
+	require.NoError(t, err)
+	links := make(model.Links, len(list))
+	for _, link := range list {
+		links[link.Short] = link
+	}
+	return links
+}
+
+func TestRepository_GetByUser(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, repo.AddItem(testUser, key, model.Link{URL: testURL + "/" + key}, ctx))
+	}
+	require.NoError(t, repo.AddItem(testUser, "market", model.Link{URL: "https://Market.yandex.ru/"}, ctx))
+	_, err := repo.RemoveItems(ctx, testUser, []string{"c"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		query model.UserLinksQuery
+		want  [][]string
+	}{
+		{name: "all", want: [][]string{{"a", "b", "d", "e", "market"}}},
+		{name: "pages", query: model.UserLinksQuery{Limit: 2}, want: [][]string{{"a", "b"}, {"d", "e"}, {"market"}}},
+		{name: "desc", query: model.UserLinksQuery{Limit: 3, Desc: true}, want: [][]string{{"market", "e", "d"}, {"b", "a"}}},
+		{name: "deleted", query: model.UserLinksQuery{Limit: 3, IncludeDeleted: true}, want: [][]string{{"a", "b", "c"}, {"d", "e", "market"}}},
+		{name: "contains", query: model.UserLinksQuery{Contains: "MARKET"}, want: [][]string{{"market"}}},
+		{name: "nothing", query: model.UserLinksQuery{Contains: "google"}, want: [][]string{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			for _, want := range tt.want {
+				links, err := repo.GetByUser(testUser, q, ctx)
+				require.NoError(t, err)
+				got := make([]string, len(links))
+				for i, link := range links {
+					got[i] = link.Short
+					assert.False(t, link.CreatedAt.IsZero())
+				}
+				assert.Equal(t, want, got)
+				if len(links) > 0 {
+					after := model.CursorOf(links[len(links)-1])
+					q.After = &after
+				}
+			}
+			if q.Limit > 0 {
+				links, err := repo.GetByUser(testUser, q, ctx)
+				require.NoError(t, err)
+				assert.Empty(t, links)
+			}
+		})
+	}
+
+	links, err := repo.GetByUser("stranger", model.UserLinksQuery{}, ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func TestRepository_BunchSave(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	shorts, err := repo.BunchSave(ctx, testUser, []model.Link{{ID: "1", URL: testURL}, {ID: "2", URL: testURL + "/2"}})
+	assert.NoError(t, err)
+	assert.Len(t, shorts, 2)
+	for _, short := range shorts {
+		assert.True(t, repo.CheckExist(short.Short))
+	}
+}
+
+func TestRepository_GetByOrigin(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	repo.AddItem(testUser, testCode, model.Link{URL: testURL}, ctx)
+
+	short, err := repo.GetByOrigin(testUser, testURL, ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, testCode, short)
+
+	_, err = repo.GetByOrigin(model.User("other"), testURL, ctx)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+
+	err = repo.AddItem(testUser, "other", model.Link{URL: testURL}, ctx)
+	assert.ErrorIs(t, err, model.ErrOriginExists)
+
+	shorts, err := repo.BunchSave(ctx, testUser, []model.Link{{ID: "1", URL: testURL}, {ID: "2", URL: testURL + "/2"}})
+	assert.NoError(t, err)
+	assert.Equal(t, model.ShortLink{ID: "1", Short: testCode, Err: model.ErrOriginExists}, shorts[0])
+	assert.NoError(t, shorts[1].Err)
+
+	shorts, err = repo.BunchSave(ctx, testUser, []model.Link{{ID: "3", URL: testURL + "/3", Alias: testCode}, {ID: "4", URL: testURL + "/4", Alias: "spring-sale"}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, shorts[0].Err, model.ErrCodeTaken)
+	assert.Equal(t, model.ShortLink{ID: "4", Short: "spring-sale"}, shorts[1])
+}
+
+func TestRepository_RemoveItems(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	repo.AddItem(testUser, testCode, model.Link{URL: testURL}, ctx)
+	repo.AddItem(testUser, "byid", model.Link{URL: testURL + "/byid"}, ctx)
+	repo.AddItem(testUser, "other", model.Link{URL: testURL + "/other"}, ctx)
+	repo.AddItem("stranger", "foreign", model.Link{URL: testURL}, ctx)
+	link, _ := repo.GetItem(testUser, "byid", ctx)
+
+	removed, err := repo.RemoveItems(ctx, testUser, []string{testCode, strconv.Itoa(link.Seq), "foreign", "missing"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, removed)
+
+	for short, deleted := range map[string]bool{testCode: true, "byid": true, "other": false, "foreign": false} {
+		link, _ = repo.GetByShort(short, ctx)
+		assert.Equal(t, deleted, link.Deleted, short)
+	}
+	// повторное удаление ничего не меняет
+	removed, err = repo.RemoveItems(ctx, testUser, []string{testCode})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, removed)
+}
+
+func TestRepository_RemoveExpired(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	expired := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	repo.AddItem(testUser, "expired", model.Link{URL: testURL, ExpiresAt: &expired}, ctx)
+	repo.AddItem(testUser, "future", model.Link{URL: testURL + "/future", ExpiresAt: &future}, ctx)
+	repo.AddItem(testUser, "forever", model.Link{URL: testURL + "/forever"}, ctx)
+
+	removed, err := repo.RemoveExpired(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, removed)
+	link, _ := repo.GetByShort("expired", ctx)
+	assert.True(t, link.Deleted)
+	link, _ = repo.GetByShort("future", ctx)
+	assert.False(t, link.Deleted)
+}
+
 func TestRepository_Flush(t *testing.T) {
 	type fields struct {
-		db              map[model.User]model.Links
 		fileStoragePath string
 	}
 	tests := []struct {
@@ -102,10 +269,7 @@ func TestRepository_Flush(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo := &Repository{
-				db:              tt.fields.db,
-				fileStoragePath: tt.fields.fileStoragePath,
-			}
+			repo := newRepository(tt.fields.fileStoragePath, testCodes)
 			if err := repo.Flush(); (err != nil) != tt.wantErr {
 				t.Errorf("Flush() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -115,7 +279,6 @@ func TestRepository_Flush(t *testing.T) {
 
 func TestRepository_load(t *testing.T) {
 	type fields struct {
-		db              map[model.User]model.Links
 		fileStoragePath string
 	}
 	tests := []struct {
@@ -127,13 +290,44 @@ func TestRepository_load(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo := &Repository{
-				db:              tt.fields.db,
-				fileStoragePath: tt.fields.fileStoragePath,
-			}
+			repo := newRepository(tt.fields.fileStoragePath, testCodes)
 			if err := repo.load(); (err != nil) != tt.wantErr {
 				t.Errorf("load() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestRepository_ClickStats(t *testing.T) {
+	repo := New("", testCodes)
+	day := time.Date(2022, 3, 1, 23, 0, 0, 0, time.UTC)
+	err := repo.SaveClicks(context.Background(), []model.Click{
+		{Short: testCode, At: day.Add(2 * time.Hour), IPHash: "a"},
+		{Short: testCode, At: day, IPHash: "a"},
+		{Short: testCode, At: day.Add(time.Hour), IPHash: "b"},
+		{Short: "other", At: day, IPHash: "c"},
+	})
+	assert.NoError(t, err)
+	stats, err := repo.ClickStats(context.Background(), testCode)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClickStats{
+		Total:  3,
+		Unique: 2,
+		Daily:  []model.DayClicks{{Day: "2022-03-01", Clicks: 1}, {Day: "2022-03-02", Clicks: 2}},
+	}, stats)
+
+	stats, err = repo.ClickStats(context.Background(), "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClickStats{Daily: []model.DayClicks{}}, stats)
+}
+
+func TestRepository_ServiceStats(t *testing.T) {
+	repo := New("", testCodes)
+	ctx := context.Background()
+	repo.AddItem(testUser, "a", model.Link{URL: testURL}, ctx)
+	repo.AddItem(testUser, "b", model.Link{URL: testURL + "/b"}, ctx)
+	repo.AddItem("stranger", "c", model.Link{URL: testURL}, ctx)
+	stats, err := repo.ServiceStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ServiceStats{URLs: 3, Users: 2}, stats)
+}
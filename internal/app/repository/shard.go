@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"hash/fnv"
+	"ilyakasharokov/internal/app/model"
+	"sync"
+)
+
+// shardCount число сегментов репозитория. Ссылки пользователя всегда лежат в одном сегменте,
+// поэтому запросы разных пользователей почти не ждут друг друга.
+const shardCount = 32
+
+// shard сегмент ссылок пользователей под своей блокировкой.
+type shard struct {
+	mu sync.RWMutex
+	db map[model.User]model.Links
+}
+
+func newShards(n int) []*shard {
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{db: make(map[model.User]model.Links)}
+	}
+	return shards
+}
+
+func (repo *Repository) shard(user model.User) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(user))
+	return repo.shards[h.Sum32()%uint32(len(repo.shards))]
+}
+
+// lockAll блокирует все сегменты на чтение, всегда в одном порядке.
+func (repo *Repository) lockAll() func() {
+	for _, s := range repo.shards {
+		s.mu.RLock()
+	}
+	return func() {
+		for _, s := range repo.shards {
+			s.mu.RUnlock()
+		}
+	}
+}
+
+// byOrigin ищет код оригинального URL пользователя, вызывается под блокировкой сегмента.
+func (s *shard) byOrigin(user model.User, origin string) (string, bool) {
+	for key, link := range s.db[user] {
+		if link.URL == origin {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// apply применяет запись журнала, вызывается под блокировкой сегмента.
+// Повторное применение записи не меняет результат.
+func (s *shard) apply(rec record) {
+	switch rec.Op {
+	case opAdd:
+		links, ok := s.db[rec.User]
+		if !ok {
+			links = model.Links{}
+			s.db[rec.User] = links
+		}
+		link := model.Link{
+			ID:        rec.ID,
+			URL:       rec.URL,
+			RawURL:    rec.RawURL,
+			ExpiresAt: rec.ExpiresAt,
+			Seq:       rec.Seq,
+			Deleted:   rec.Deleted,
+		}
+		if rec.CreatedAt != nil {
+			link.CreatedAt = *rec.CreatedAt
+		}
+		links[rec.Key] = link
+	case opDelete:
+		if link, ok := s.db[rec.User][rec.Key]; ok {
+			link.Deleted = true
+			s.db[rec.User][rec.Key] = link
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ilyakasharokov/internal/app/model"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hammer параллельно добавляет, читает и удаляет ссылки users пользователей, по perUser ссылок на каждого.
+// Каждая вторая ссылка удаляется.
+func hammer(t *testing.T, repo *Repository, users int, perUser int) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for u := 0; u < users; u++ {
+		user := model.User(fmt.Sprintf("user-%d", u))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perUser; i++ {
+				key := fmt.Sprintf("%s-%d", user, i)
+				if !assert.NoError(t, repo.AddItem(user, key, model.Link{URL: "https://" + key}, ctx)) {
+					return
+				}
+				_, err := repo.GetItem(user, key, ctx)
+				assert.NoError(t, err)
+				if i%2 == 1 {
+					_, err := repo.RemoveItems(ctx, user, []string{key})
+					assert.NoError(t, err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perUser; i++ {
+				links, err := repo.GetByUser(user, model.UserLinksQuery{Limit: 10}, ctx)
+				assert.NoError(t, err)
+				for _, link := range links {
+					_, err := repo.GetByShort(link.Short, ctx)
+					assert.NoError(t, err)
+				}
+				_, err = repo.RemoveExpired(ctx)
+				assert.NoError(t, err)
+				_, err = repo.ServiceStats(ctx)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func checkHammered(t *testing.T, repo *Repository, users int, perUser int) {
+	ctx := context.Background()
+	seqs := make(map[int]bool)
+	for u := 0; u < users; u++ {
+		user := model.User(fmt.Sprintf("user-%d", u))
+		links := userLinks(t, repo, user)
+		require.Len(t, links, perUser)
+		for i := 0; i < perUser; i++ {
+			link, ok := links[fmt.Sprintf("%s-%d", user, i)]
+			require.True(t, ok)
+			assert.Equal(t, i%2 == 1, link.Deleted)
+			assert.False(t, seqs[link.Seq], "duplicate seq %d", link.Seq)
+			seqs[link.Seq] = true
+		}
+	}
+	stats, err := repo.ServiceStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, model.ServiceStats{URLs: int64(users * perUser), Users: int64(users)}, stats)
+}
+
+func TestRepository_Concurrent(t *testing.T) {
+	repo := New("", testCodes)
+	hammer(t, repo, 16, 50)
+	checkHammered(t, repo, 16, 50)
+}
+
+func TestRepository_ConcurrentLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage")
+	opts := Options{Sync: SyncNever, CompactEvery: 25}
+	repo := openTest(t, path, opts)
+	hammer(t, repo, 8, 40)
+	require.NoError(t, repo.Close())
+
+	restored := openTest(t, path, opts)
+	defer restored.Close()
+	checkHammered(t, restored, 8, 40)
+}
+
+func TestRepository_ConcurrentSameCode(t *testing.T) {
+	repo := New("", testCodes)
+	var added int32
+	var wg sync.WaitGroup
+	for u := 0; u < 16; u++ {
+		user := model.User(fmt.Sprintf("user-%d", u))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.AddItem(user, "alias", model.Link{URL: testURL}, context.Background())
+			if err == nil {
+				atomic.AddInt32(&added, 1)
+				return
+			}
+			assert.ErrorIs(t, err, model.ErrCodeTaken)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, added)
+}
+
+// BenchmarkRepository сравнивает сегментированный репозиторий с вариантом из одного сегмента,
+// то есть под одной общей блокировкой. Нагрузка: 90% чтений по коду, 10% добавлений.
+func BenchmarkRepository(b *testing.B) {
+	for _, n := range []int{1, shardCount} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			ctx := context.Background()
+			repo := newRepository("", testCodes)
+			repo.shards = newShards(n)
+			const users = 256
+			for u := 0; u < users; u++ {
+				user := model.User(fmt.Sprintf("user-%d", u))
+				require.NoError(b, repo.AddItem(user, string(user), model.Link{URL: "https://" + string(user)}, ctx))
+			}
+			var next int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := atomic.AddInt64(&next, 1)
+					user := model.User(fmt.Sprintf("user-%d", i%users))
+					if i%10 == 0 {
+						key := fmt.Sprintf("key-%d", i)
+						_ = repo.AddItem(user, key, model.Link{URL: "https://" + key}, ctx)
+						continue
+					}
+					_, _ = repo.GetByShort(string(user), ctx)
+				}
+			})
+		})
+	}
+}
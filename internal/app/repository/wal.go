@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ilyakasharokov/internal/app/model"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SyncPolicy определяет, когда журнал сбрасывается на диск.
+type SyncPolicy string
+
+const (
+	// SyncAlways fsync после каждой записи.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval fsync раз в Options.SyncInterval, при сбое ОС теряются записи за последний период.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever сброс на диск остается на усмотрение ОС.
+	SyncNever SyncPolicy = "never"
+)
+
+// Options настройки журнала фаилового хранилища.
+type Options struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	// CompactEvery число записей в журнале, после которого он сворачивается в снимок. 0 отключает свертку.
+	CompactEvery int
+}
+
+// DefaultOptions настройки журнала по умолчанию.
+var DefaultOptions = Options{
+	Sync:         SyncInterval,
+	SyncInterval: time.Second,
+	CompactEvery: 10000,
+}
+
+func (opts Options) validate() error {
+	switch opts.Sync {
+	case SyncAlways, SyncNever:
+		return nil
+	case SyncInterval:
+		if opts.SyncInterval <= 0 {
+			return errors.New("file sync interval must be positive")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown file sync policy %q", opts.Sync)
+}
+
+const (
+	opAdd    = "add"
+	opDelete = "delete"
+)
+
+// record строка журнала и снимка. Снимок состоит только из записей add с актуальным Deleted.
+type record struct {
+	Op        string     `json:"op"`
+	User      model.User `json:"user"`
+	Key       string     `json:"key"`
+	ID        string     `json:"correlation_id,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	RawURL    string     `json:"raw_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Seq       int        `json:"seq,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+func addRecord(user model.User, key string, link model.Link) record {
+	rec := record{
+		Op:        opAdd,
+		User:      user,
+		Key:       key,
+		ID:        link.ID,
+		URL:       link.URL,
+		RawURL:    link.RawURL,
+		ExpiresAt: link.ExpiresAt,
+		Seq:       link.Seq,
+		Deleted:   link.Deleted,
+	}
+	if !link.CreatedAt.IsZero() {
+		createdAt := link.CreatedAt
+		rec.CreatedAt = &createdAt
+	}
+	return rec
+}
+
+func walPath(fileStoragePath string) string {
+	return fileStoragePath + ".wal"
+}
+
+// wal журнал изменений в формате JSON lines. Каждая запись пишется в фаил сразу,
+// поэтому падение процесса ее не теряет, а от сбоя ОС защищает fsync по SyncPolicy.
+type wal struct {
+	mu      sync.Mutex
+	file    *os.File
+	opts    Options
+	records int
+	dirty   bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func openLog(path string, opts Options) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w := &wal{file: file, opts: opts}
+	if opts.Sync == SyncInterval {
+		w.stop = make(chan struct{})
+		w.done = make(chan struct{})
+		go w.syncLoop()
+	}
+	return w, nil
+}
+
+func (w *wal) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.sync(); err != nil {
+				log.Err(err).Msg("Log sync error")
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.file.Sync()
+}
+
+// append дописывает записи одним вызовом write.
+func (w *wal) append(recs ...record) error {
+	if w == nil || len(recs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	w.records += len(recs)
+	if w.opts.Sync == SyncAlways {
+		return w.file.Sync()
+	}
+	w.dirty = true
+	return nil
+}
+
+// full сообщает, пора ли сворачивать журнал.
+func (w *wal) full() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.opts.CompactEvery > 0 && w.records >= w.opts.CompactEvery
+}
+
+func (w *wal) close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// compact записывает снимок во временный фаил, подменяет им прежний и очищает журнал.
+// Если процесс упадет до очистки, повторное применение журнала к новому снимку даст то же состояние.
+func (repo *Repository) compact() error {
+	w := repo.log
+	if w == nil {
+		return nil
+	}
+	// сегменты блокируются раньше журнала, как и при записи
+	unlock := repo.lockAll()
+	defer unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := repo.writeSnapshot(); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.records = 0
+	w.dirty = false
+	return nil
+}
+
+func (repo *Repository) writeSnapshot() error {
+	tmp := repo.fileStoragePath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	enc := json.NewEncoder(writer)
+	for _, s := range repo.shards {
+		for user, links := range s.db {
+			for key, link := range links {
+				if err := enc.Encode(addRecord(user, key, link)); err != nil {
+					f.Close()
+					return err
+				}
+			}
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, repo.fileStoragePath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(repo.fileStoragePath))
+}
+
+// syncDir сохраняет на диске переименование внутри каталога.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// loadSnapshot читает снимок. Снимок в прежнем формате gob тоже читается,
+// при открытии он будет переписан в JSON lines.
+func (repo *Repository) loadSnapshot() error {
+	f, err := os.Open(repo.fileStoragePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	first, err := reader.Peek(1)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if first[0] != '{' {
+		db := make(map[model.User]model.Links)
+		if err := gob.NewDecoder(reader).Decode(&db); err != nil {
+			return err
+		}
+		// в прежнем формате нет порядковых номеров, ссылки нумеруются по пользователю и коду,
+		// чтобы курсоры списка ссылок не совпадали
+		users := make([]model.User, 0, len(db))
+		for user := range db {
+			users = append(users, user)
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+		for _, user := range users {
+			keys := make([]string, 0, len(db[user]))
+			for key := range db[user] {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				link := db[user][key]
+				repo.seq++
+				link.Seq = int(repo.seq)
+				repo.apply(addRecord(user, key, link))
+			}
+		}
+		return nil
+	}
+	dec := json.NewDecoder(reader)
+	for {
+		var rec record
+		err := dec.Decode(&rec)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", repo.fileStoragePath, err)
+		}
+		repo.apply(rec)
+	}
+}
+
+// apply применяет запись при загрузке, до начала работы с репозиторием.
+func (repo *Repository) apply(rec record) {
+	repo.shard(rec.User).apply(rec)
+}
+
+// replay применяет журнал. Недописанная последняя строка остается от падения во время записи
+// и отрезается, поврежденная строка в середине журнала считается ошибкой.
+func (repo *Repository) replay(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) == 0 {
+				return nil
+			}
+			return truncateTail(path, offset)
+		}
+		if err != nil {
+			return err
+		}
+		var rec record
+		if jerr := json.Unmarshal(line, &rec); jerr != nil {
+			if _, perr := reader.Peek(1); perr == io.EOF {
+				return truncateTail(path, offset)
+			}
+			return fmt.Errorf("log %s at offset %d: %w", path, offset, jerr)
+		}
+		repo.apply(rec)
+		offset += int64(len(line))
+	}
+}
+
+func truncateTail(path string, offset int64) error {
+	log.Warn().Str("path", path).Int64("offset", offset).Msg("Truncating incomplete log record")
+	return os.Truncate(path, offset)
+}
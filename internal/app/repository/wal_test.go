@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"encoding/gob"
+	"ilyakasharokov/internal/app/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTest(t *testing.T, path string, opts Options) *Repository {
+	t.Helper()
+	repo, err := Open(path, testCodes, opts)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestRepository_Replay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage")
+	opts := Options{Sync: SyncAlways}
+	repo := openTest(t, path, opts)
+	require.NoError(t, repo.AddItem(testUser, "a", model.Link{URL: "https://a.ru"}, ctx))
+	require.NoError(t, repo.AddItem(testUser, "b", model.Link{URL: "https://b.ru"}, ctx))
+	removed, err := repo.RemoveItems(ctx, testUser, []string{"a"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, removed)
+
+	// процесс упал без Close, снимок пустой, все изменения в журнале
+	restored := openTest(t, path, opts)
+	defer restored.Close()
+	a, err := restored.GetByShort("a", ctx)
+	require.NoError(t, err)
+	assert.True(t, a.Deleted)
+	b, err := restored.GetByShort("b", ctx)
+	require.NoError(t, err)
+	assert.False(t, b.Deleted)
+	assert.Equal(t, 2, b.Seq)
+
+	require.NoError(t, restored.AddItem(testUser, "c", model.Link{URL: "https://c.ru"}, ctx))
+	c, _ := restored.GetByShort("c", ctx)
+	assert.Equal(t, 3, c.Seq)
+}
+
+func TestRepository_RawURL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage")
+	repo := openTest(t, path, Options{Sync: SyncAlways})
+	link := model.Link{URL: "https://a.ru/?a=1&b=2", RawURL: "HTTPS://A.ru?b=2&a=1"}
+	require.NoError(t, repo.AddItem(testUser, "a", link, ctx))
+	_, err := repo.BunchSave(ctx, testUser, []model.Link{{ID: "1", URL: "https://b.ru/", RawURL: "https://B.ru"}})
+	require.NoError(t, err)
+
+	// из журнала
+	restored := openTest(t, path, Options{Sync: SyncAlways})
+	links := userLinks(t, restored, testUser)
+	assert.Equal(t, link.RawURL, links["a"].RawURL)
+	require.NoError(t, restored.Close())
+
+	// из снимка
+	restored = openTest(t, path, Options{Sync: SyncAlways})
+	defer restored.Close()
+	links = userLinks(t, restored, testUser)
+	assert.Equal(t, link.RawURL, links["a"].RawURL)
+	for _, l := range links {
+		if l.ID == "1" {
+			assert.Equal(t, "https://B.ru", l.RawURL)
+		}
+	}
+}
+
+func TestRepository_CreatedAt(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage")
+	repo := openTest(t, path, Options{Sync: SyncAlways})
+	require.NoError(t, repo.AddItem(testUser, "a", model.Link{URL: "https://a.ru"}, ctx))
+	link, err := repo.GetItem(testUser, "a", ctx)
+	require.NoError(t, err)
+	assert.False(t, link.CreatedAt.IsZero())
+
+	// из журнала, затем из снимка
+	for i := 0; i < 2; i++ {
+		restored := openTest(t, path, Options{Sync: SyncAlways})
+		got, err := restored.GetItem(testUser, "a", ctx)
+		require.NoError(t, err)
+		assert.True(t, link.CreatedAt.Equal(got.CreatedAt))
+		require.NoError(t, restored.Close())
+	}
+}
+
+func TestRepository_ReplayTornTail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage")
+	opts := Options{Sync: SyncNever}
+	repo := openTest(t, path, opts)
+	require.NoError(t, repo.AddItem(testUser, "a", model.Link{URL: "https://a.ru"}, ctx))
+
+	f, err := os.OpenFile(walPath(path), os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"add","user":"default","key":"b","ur`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restored := openTest(t, path, opts)
+	_, err = restored.GetByShort("a", ctx)
+	assert.NoError(t, err)
+	_, err = restored.GetByShort("b", ctx)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	require.NoError(t, restored.AddItem(testUser, "c", model.Link{URL: "https://c.ru"}, ctx))
+	require.NoError(t, restored.Close())
+
+	restored = openTest(t, path, opts)
+	defer restored.Close()
+	_, err = restored.GetByShort("c", ctx)
+	assert.NoError(t, err)
+}
+
+func TestRepository_ReplayCorrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage")
+	log := "not json\n" + `{"op":"add","user":"default","key":"a","url":"https://a.ru","seq":1}` + "\n"
+	require.NoError(t, os.WriteFile(walPath(path), []byte(log), 0600))
+	_, err := Open(path, testCodes, DefaultOptions)
+	assert.Error(t, err)
+}
+
+func TestRepository_Compact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage")
+	opts := Options{Sync: SyncInterval, SyncInterval: time.Millisecond, CompactEvery: 2}
+	repo := openTest(t, path, opts)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, repo.AddItem(testUser, key, model.Link{URL: "https://" + key + ".ru"}, ctx))
+	}
+	info, err := os.Stat(walPath(path))
+	require.NoError(t, err)
+	snapshot, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(snapshot), `"key":"b"`)
+	assert.NotContains(t, string(snapshot), `"key":"c"`)
+	assert.NotZero(t, info.Size())
+
+	require.NoError(t, repo.Close())
+	info, err = os.Stat(walPath(path))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+	_, err = os.Stat(path + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	restored := openTest(t, path, opts)
+	defer restored.Close()
+	links := userLinks(t, restored, testUser)
+	assert.Len(t, links, 3)
+}
+
+func TestRepository_LegacySnapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	db := map[model.User]model.Links{testUser: {"a": {URL: "https://a.ru"}, "b": {URL: "https://b.ru"}}}
+	require.NoError(t, gob.NewEncoder(f).Encode(db))
+	require.NoError(t, f.Close())
+
+	repo := openTest(t, path, DefaultOptions)
+	defer repo.Close()
+	link, err := repo.GetByShort("a", ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.ru", link.URL)
+	links := userLinks(t, repo, testUser)
+	assert.Equal(t, 1, links["a"].Seq)
+	assert.Equal(t, 2, links["b"].Seq)
+	snapshot, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, byte('{'), snapshot[0])
+}
+
+func TestOptions_validate(t *testing.T) {
+	assert.NoError(t, DefaultOptions.validate())
+	assert.Error(t, Options{Sync: "sometimes"}.validate())
+	assert.Error(t, Options{Sync: SyncInterval}.validate())
+}
@@ -0,0 +1,69 @@
+package repositorydb
+
+import (
+	"context"
+	"database/sql"
+	"ilyakasharokov/internal/app/model"
+
+	"github.com/lib/pq"
+)
+
+// Сохранение пакета переходов через COPY.
+func (repo *RepositoryDB) SaveClicks(ctx context.Context, clicks []model.Click) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("clicks", "short_url", "clicked_at", "referrer", "user_agent", "ip_hash"))
+	if err != nil {
+		return err
+	}
+	for _, c := range clicks {
+		if _, err = stmt.ExecContext(ctx, c.Short, c.At, c.Referrer, c.UserAgent, c.IPHash); err != nil {
+			_ = stmt.Close()
+			return err
+		}
+	}
+	// Пустой Exec завершает COPY
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		_ = stmt.Close()
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Статистика переходов по короткому коду: всего, уникальные посетители и гистограмма по дням UTC.
+func (repo *RepositoryDB) ClickStats(ctx context.Context, short string) (model.ClickStats, error) {
+	stats := model.ClickStats{Daily: []model.DayClicks{}}
+	query := `
+		select count(*), count(distinct ip_hash) from clicks where short_url=$1
+	`
+	err := repo.db.QueryRowContext(ctx, query, short).Scan(&stats.Total, &stats.Unique)
+	if err != nil {
+		return stats, err
+	}
+	query = `
+		select to_char(clicked_at at time zone 'UTC', 'YYYY-MM-DD') as day, count(*)
+		from clicks where short_url=$1
+		group by day order by day
+	`
+	rows, err := repo.db.QueryContext(ctx, query, short)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day model.DayClicks
+		if err = rows.Scan(&day.Day, &day.Clicks); err != nil {
+			return stats, err
+		}
+		stats.Daily = append(stats.Daily, day)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,89 @@
+package repositorydb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"ilyakasharokov/internal/app/model"
+
+	"github.com/lib/pq"
+)
+
+// Сохранение новой задачи удаления.
+func (repo *RepositoryDB) CreateDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	query := `
+		insert into delete_jobs (id, user_id, items, status, total, deleted, error, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := repo.db.ExecContext(ctx, query, job.ID, job.User, pq.Array(job.Items), job.Status,
+		job.Total, job.Deleted, job.Error, job.CreatedAt, job.UpdatedAt)
+	return err
+}
+
+// Обновление состояния задачи удаления.
+func (repo *RepositoryDB) UpdateDeleteJob(ctx context.Context, job model.DeleteJob) error {
+	query := `
+		update delete_jobs set status=$2, deleted=$3, error=$4, updated_at=$5 where id=$1
+	`
+	_, err := repo.db.ExecContext(ctx, query, job.ID, job.Status, job.Deleted, job.Error, job.UpdatedAt)
+	return err
+}
+
+// Получение задачи удаления пользователя.
+func (repo *RepositoryDB) GetDeleteJob(ctx context.Context, user model.User, id string) (model.DeleteJob, error) {
+	query := `
+		select id, user_id, items, status, total, deleted, error, created_at, updated_at
+		from delete_jobs where id=$1 and user_id=$2
+	`
+	job, err := scanDeleteJob(repo.db.QueryRowContext(ctx, query, id, user))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.DeleteJob{}, model.ErrNotFound
+	}
+	return job, err
+}
+
+// Незавершенные задачи удаления в порядке создания.
+func (repo *RepositoryDB) PendingDeleteJobs(ctx context.Context) ([]model.DeleteJob, error) {
+	query := `
+		select id, user_id, items, status, total, deleted, error, created_at, updated_at
+		from delete_jobs where status in ($1, $2) order by created_at
+	`
+	rows, err := repo.db.QueryContext(ctx, query, model.JobQueued, model.JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []model.DeleteJob
+	for rows.Next() {
+		job, err := scanDeleteJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Возврат завершившихся ошибкой задач удаления в очередь.
+func (repo *RepositoryDB) RetryFailedDeleteJobs(ctx context.Context) (int64, error) {
+	query := `
+		update delete_jobs set status=$1, error='', updated_at=now() where status=$2
+	`
+	res, err := repo.db.ExecContext(ctx, query, model.JobQueued, model.JobFailed)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// rowScanner общий интерфейс *sql.Row и *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDeleteJob(row rowScanner) (model.DeleteJob, error) {
+	var job model.DeleteJob
+	err := row.Scan(&job.ID, &job.User, pq.Array(&job.Items), &job.Status, &job.Total,
+		&job.Deleted, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	return job, err
+}
@@ -4,45 +4,106 @@ package repositorydb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	helpers "ilyakasharokov/internal/app/encryptor"
 	"ilyakasharokov/internal/app/model"
+	"ilyakasharokov/internal/app/shortcode"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
 type RepositoryDB struct {
-	db *sql.DB
+	db    *sql.DB
+	codes *shortcode.Allocator
 }
 
 // Добавление URL в базу.
 func (repo *RepositoryDB) AddItem(user model.User, key string, link model.Link, ctx context.Context) error {
 	query := `
-	insert into urls (id, user_id, origin_url, short_url) 
-	values (default, $1, $2, $3)
-	ON CONFLICT (short_url) DO NOTHING
+	insert into urls (id, user_id, origin_url, short_url, expires_at, raw_url) 
+	values (default, $1, $2, $3, $4, $5)
+	ON CONFLICT DO NOTHING
 	`
-	_, err := repo.db.ExecContext(ctx, query, user, link.URL, key)
+	result, err := repo.db.ExecContext(ctx, query, user, link.URL, key, link.ExpiresAt, link.RawURL)
 	if err != nil {
 		return err
 	}
-
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return conflictReason(ctx, repo.db, user, link.URL)
+	}
 	return nil
 }
 
+// queryRower общий интерфейс *sql.DB и *sql.Tx для запросов одной строки.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conflictReason определяет, какое ограничение не дало вставить ссылку.
+func conflictReason(ctx context.Context, q queryRower, user model.User, origin string) error {
+	_, err := originShort(ctx, q, user, origin)
+	if err == nil {
+		return model.ErrOriginExists
+	}
+	if errors.Is(err, model.ErrNotFound) {
+		return model.ErrCodeTaken
+	}
+	return err
+}
+
+func originShort(ctx context.Context, q queryRower, user model.User, origin string) (string, error) {
+	query := `
+		select short_url from urls where user_id=$1 and origin_url=$2
+	`
+	var short string
+	err := q.QueryRowContext(ctx, query, user, origin).Scan(&short)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", model.ErrNotFound
+	}
+	return short, err
+}
+
 // Получение URL по ключу.
 func (repo *RepositoryDB) GetItem(user model.User, key string, ctx context.Context) (model.Link, error) {
 	query := `
-		select origin_url, deleted from urls where user_id=$1 and short_url=$2
+		select origin_url, coalesce(raw_url, ''), deleted, expires_at from urls where user_id=$1 and short_url=$2
 	`
 	result := repo.db.QueryRowContext(ctx, query, user, key)
 	link := model.Link{}
-	err := result.Scan(&link.URL, &link.Deleted)
+	err := result.Scan(&link.URL, &link.RawURL, &link.Deleted, &link.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Link{}, model.ErrNotFound
+	}
 	if err != nil {
 		return model.Link{}, err
 	}
 	return link, nil
 }
 
-// Удаление множества URL по id.
+// Получение URL по короткому коду без учета пользователя.
+func (repo *RepositoryDB) GetByShort(key string, ctx context.Context) (model.Link, error) {
+	query := `
+		select id, origin_url, deleted, expires_at from urls where short_url=$1
+	`
+	result := repo.db.QueryRowContext(ctx, query, key)
+	link := model.Link{}
+	err := result.Scan(&link.Seq, &link.URL, &link.Deleted, &link.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Link{}, model.ErrNotFound
+	}
+	if err != nil {
+		return model.Link{}, err
+	}
+	return link, nil
+}
+
+// Удаление URL по id.
 func (repo *RepositoryDB) RemoveItem(user model.User, id int, ctx context.Context) error {
 	query := `
 		update urls set deleted = true where user_id=$1 and id=$2
@@ -54,161 +115,293 @@ func (repo *RepositoryDB) RemoveItem(user model.User, id int, ctx context.Contex
 	return nil
 }
 
-// Удаление множества URL по id.
-func (repo *RepositoryDB) RemoveItems(user model.User, ids []int) error {
+// Пометка удаленными ссылок пользователя по коротким кодам или числовым id одним запросом.
+func (repo *RepositoryDB) RemoveItems(ctx context.Context, user model.User, items []string) (int64, error) {
 	query := `
-		update urls set deleted = true where user_id=$1 and id=$2
+		update urls set deleted = true
+		where user_id=$1 and not deleted and (short_url = ANY($2) or id::text = ANY($2))
 	`
-	tx, err := repo.db.Begin()
+	result, err := repo.db.ExecContext(ctx, query, user, pq.Array(items))
 	if err != nil {
-		fmt.Println(err)
-		return err
-	}
-	for _, id := range ids {
-		_, err = tx.Exec(query, string(user), id)
-		if err != nil {
-			fmt.Println(err)
-		}
+		return 0, err
 	}
-	err = tx.Commit()
+	return result.RowsAffected()
+}
+
+// Пометка удаленными всех ссылок с истекшим сроком действия.
+func (repo *RepositoryDB) RemoveExpired(ctx context.Context) (int64, error) {
+	query := `
+		update urls set deleted = true where not deleted and expires_at <= now()
+	`
+	result, err := repo.db.ExecContext(ctx, query)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return 0, err
 	}
-	return nil
+	return result.RowsAffected()
 }
 
-// Получение всех URL пользователя.
-func (repo *RepositoryDB) GetByUser(user model.User, ctx context.Context) (model.Links, error) {
+// Число сокращенных URL и пользователей.
+func (repo *RepositoryDB) ServiceStats(ctx context.Context) (model.ServiceStats, error) {
 	query := `
-		select origin_url, short_url from urls where user_id=$1
+		select count(*), count(distinct user_id) from urls
 	`
-	links := model.Links{}
-	result, err := repo.db.QueryContext(ctx, query, user)
+	var stats model.ServiceStats
+	err := repo.db.QueryRowContext(ctx, query).Scan(&stats.URLs, &stats.Users)
+	return stats, err
+}
+
+// Получение URL пользователя по условиям q, упорядоченных по времени создания.
+func (repo *RepositoryDB) GetByUser(user model.User, q model.UserLinksQuery, ctx context.Context) ([]model.Link, error) {
+	query, args := userLinksQuery(user, q)
+	result, err := repo.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return model.Links{}, err
+		return nil, err
 	}
-	defer func() {
-		_ = result.Close()
-		_ = result.Err() // or modify return value
-	}()
+	defer result.Close()
+	var links []model.Link
 	for result.Next() {
-		link := model.Link{}
-		var key string
-		result.Scan(&link.URL, &key)
-		links[key] = link
+		var link model.Link
+		err := result.Scan(&link.Seq, &link.Short, &link.URL, &link.RawURL, &link.CreatedAt, &link.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
 	}
-	return links, nil
+	return links, result.Err()
 }
 
-// Проверка существования пользовательского URL в базе.
-func (repo *RepositoryDB) CheckExist(user model.User, key string) bool {
-	var exist bool
+// userLinksQuery строит запрос ссылок пользователя. Страница выбирается по курсору
+// (created_at, id), что использует индекс urls_user_created_idx.
+func userLinksQuery(user model.User, q model.UserLinksQuery) (string, []interface{}) {
 	query := `
-		select 1 from urls where user_id=$1 and short_url=$2
-	`
-	result, err := repo.db.Query(query, user, key)
-	if err != nil {
-		return false
+		select id, short_url, origin_url, coalesce(raw_url, ''), created_at, deleted from urls
+		where user_id=$1`
+	args := []interface{}{user}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
 	}
-	defer func() {
-		_ = result.Close()
-		_ = result.Err() // or modify return value
-	}()
-	result.Scan(&exist)
-	return exist
+	if !q.IncludeDeleted {
+		query += " and not deleted"
+	}
+	if q.Contains != "" {
+		query += " and strpos(lower(origin_url), lower(" + arg(q.Contains) + ")) > 0"
+	}
+	order, cmp := "asc", ">"
+	if q.Desc {
+		order, cmp = "desc", "<"
+	}
+	if q.After != nil {
+		query += " and (created_at, id) " + cmp + " (" + arg(q.After.CreatedAt) + ", " + arg(q.After.Seq) + ")"
+	}
+	query += " order by created_at " + order + ", id " + order
+	if q.Limit > 0 {
+		query += " limit " + arg(q.Limit)
+	}
+	return query, args
 }
 
-// Проверка существования оригинального URL в базе.
-func (repo *RepositoryDB) CheckExistOrigin(user model.User, key string, ctx context.Context) model.ShortLink {
-	var link = model.ShortLink{}
+// Проверка, занят ли короткий код любым пользователем.
+func (repo *RepositoryDB) CheckExist(key string) bool {
+	var exist bool
 	query := `
-		select short_url from urls where user_id=$1 and origin_url=$2
+		select exists(select 1 from urls where short_url=$1)
 	`
-	result := repo.db.QueryRowContext(ctx, query, user, key)
-	err := result.Scan(&link.Short)
+	err := repo.db.QueryRow(query, key).Scan(&exist)
 	if err != nil {
-		return link
+		return false
 	}
+	return exist
+}
 
-	defer func() {
-		_ = result.Err() // or modify return value
-	}()
-	result.Scan(&link)
-	return link
+// Получение короткого кода, под которым пользователь ранее сохранил оригинальный URL.
+func (repo *RepositoryDB) GetByOrigin(user model.User, origin string, ctx context.Context) (string, error) {
+	return originShort(ctx, repo.db, user, origin)
 }
 
-// Сохранение множества URL.
+// bunchChunk наибольшее число ссылок в одном запросе вставки.
+const bunchChunk = 1000
+
+// Сохранение множества URL в одной транзакции. Ссылки вставляются многострочными запросами
+// по bunchChunk строк, конфликты определяются одним запросом на каждую часть.
 func (repo *RepositoryDB) BunchSave(ctx context.Context, user model.User, links []model.Link) ([]model.ShortLink, error) {
-	// Generate shorts
-	type temp struct {
-		ID,
-		Origin,
-		Short string
-	}
-
-	var buffer []temp
-	for _, v := range links {
-		var t = temp{
-			ID:     v.ID,
-			Origin: v.URL,
-			Short:  helpers.RandomString(10),
-		}
-		buffer = append(buffer, t)
+	shorts, err := repo.allocate(ctx, links)
+	if err != nil {
+		return nil, err
 	}
-	dbd := repo.db
-	var shorts []model.ShortLink
-
-	// Start transaction
-	tx, err := dbd.Begin()
+	tx, err := repo.db.BeginTx(ctx, nil)
 	if err != nil {
-		return shorts, err
+		return nil, err
 	}
-	// Rollback handler
 	defer func(tx *sql.Tx) {
 		_ = tx.Rollback()
 	}(tx)
-	// Prepare statement
-	stmt, err := tx.PrepareContext(ctx, `
-		insert into urls (id, user_id, origin_url, short_url, correlation_id) 
-		values (default, $1, $2, $3, $4)
-		on conflict (short_url) do nothing;
-	`)
-	if err != nil {
-		return shorts, err
-	}
-	// Close statement
-	defer func(stmt *sql.Stmt) {
-		errr := stmt.Close()
-		if errr != nil {
-			fmt.Println(errr)
+	result := make([]model.ShortLink, len(links))
+	for start := 0; start < len(links); start += bunchChunk {
+		end := start + bunchChunk
+		if end > len(links) {
+			end = len(links)
 		}
-	}(stmt)
-
-	for _, v := range buffer {
-		// Add record to transaction
-		fmt.Println(v.Origin)
-		if _, err = stmt.ExecContext(ctx, user, v.Origin, v.Short, v.ID); err == nil {
-			shorts = append(shorts, model.ShortLink{
-				Short: v.Short,
-				ID:    v.ID,
+		err := insertChunk(ctx, tx, user, links[start:end], shorts[start:end], result[start:end])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// allocate подбирает коды ссылкам пакета. Занятость кодов в базе проверяется одним запросом,
+// подбор с проверкой каждого кода нужен только при коллизии.
+func (repo *RepositoryDB) allocate(ctx context.Context, links []model.Link) ([]string, error) {
+	shorts := make([]string, len(links))
+	batch := make(map[string]bool, len(links))
+	for i, v := range links {
+		short := v.Alias
+		if short == "" {
+			var err error
+			short, err = repo.codes.Allocate(v.URL, func(code string) bool {
+				return batch[code]
 			})
-		} else {
-			return shorts, err
+			if err != nil {
+				return nil, err
+			}
 		}
+		shorts[i] = short
+		batch[short] = true
 	}
-	// шаг 4 — сохраняем изменения
-	err = tx.Commit()
+	taken, err := takenCodes(ctx, repo.db, shorts)
 	if err != nil {
 		return nil, err
 	}
-
+	for i, v := range links {
+		if v.Alias != "" || !taken[shorts[i]] {
+			continue
+		}
+		short, err := repo.codes.Allocate(v.URL, func(code string) bool {
+			return batch[code] || taken[code] || repo.CheckExist(code)
+		})
+		if err != nil {
+			return nil, err
+		}
+		shorts[i] = short
+		batch[short] = true
+	}
 	return shorts, nil
 }
 
-func New(db_ *sql.DB) *RepositoryDB {
+// takenCodes коды из codes, уже занятые в базе.
+func takenCodes(ctx context.Context, db *sql.DB, codes []string) (map[string]bool, error) {
+	query := `
+		select short_url from urls where short_url = any($1)
+	`
+	rows, err := db.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		taken[code] = true
+	}
+	return taken, rows.Err()
+}
+
+// insertChunk вставляет ссылки одним запросом и заполняет result. Если пользователь уже сохранял
+// URL, в том числе ранее в этой же транзакции, в result попадает прежний код и ErrOriginExists.
+func insertChunk(ctx context.Context, tx *sql.Tx, user model.User, links []model.Link, shorts []string, result []model.ShortLink) error {
+	var query strings.Builder
+	query.WriteString("insert into urls (user_id, origin_url, short_url, correlation_id, expires_at, raw_url) values ")
+	args := []interface{}{user}
+	for i, v := range links {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($1, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+		args = append(args, v.URL, shorts[i], v.ID, v.ExpiresAt, v.RawURL)
+	}
+	query.WriteString(" on conflict do nothing returning origin_url, short_url")
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return err
+	}
+	type key struct{ origin, short string }
+	inserted := make(map[key]bool, len(links))
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.origin, &k.short); err != nil {
+			rows.Close()
+			return err
+		}
+		inserted[k] = true
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var missing []string
+	for i, v := range links {
+		result[i] = model.ShortLink{ID: v.ID, Short: shorts[i]}
+		k := key{v.URL, shorts[i]}
+		if inserted[k] {
+			// одинаковые строки пакета вставлены один раз
+			delete(inserted, k)
+			continue
+		}
+		result[i].Short = ""
+		result[i].Err = model.ErrCodeTaken
+		missing = append(missing, v.URL)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	stored, err := originShorts(ctx, tx, user, missing)
+	if err != nil {
+		return err
+	}
+	for i := range result {
+		if short, ok := stored[links[i].URL]; ok && result[i].Err != nil {
+			result[i].Short = short
+			result[i].Err = model.ErrOriginExists
+		}
+	}
+	return nil
+}
+
+// originShorts коды, под которыми пользователь сохранил оригинальные URL из origins.
+func originShorts(ctx context.Context, tx *sql.Tx, user model.User, origins []string) (map[string]string, error) {
+	query := `
+		select origin_url, short_url from urls where user_id=$1 and origin_url = any($2)
+	`
+	rows, err := tx.QueryContext(ctx, query, user, pq.Array(origins))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make(map[string]string, len(origins))
+	for rows.Next() {
+		var origin, short string
+		if err := rows.Scan(&origin, &short); err != nil {
+			return nil, err
+		}
+		stored[origin] = short
+	}
+	return stored, rows.Err()
+}
+
+func New(db_ *sql.DB, codes *shortcode.Allocator) *RepositoryDB {
 	repo := RepositoryDB{
-		db: db_,
+		db:    db_,
+		codes: codes,
 	}
 	return &repo
 }
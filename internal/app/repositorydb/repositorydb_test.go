@@ -4,7 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"ilyakasharokov/internal/app/model"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRepositoryDB_AddItem(t *testing.T) {
@@ -42,8 +46,7 @@ func TestRepositoryDB_CheckExist(t *testing.T) {
 		db *sql.DB
 	}
 	type args struct {
-		user model.User
-		key  string
+		key string
 	}
 	tests := []struct {
 		name   string
@@ -58,7 +61,7 @@ func TestRepositoryDB_CheckExist(t *testing.T) {
 			repo := &RepositoryDB{
 				db: tt.fields.db,
 			}
-			if got := repo.CheckExist(tt.args.user, tt.args.key); got != tt.want {
+			if got := repo.CheckExist(tt.args.key); got != tt.want {
 				t.Errorf("CheckExist() = %v, want %v", got, tt.want)
 			}
 		})
@@ -99,8 +102,9 @@ func TestRepositoryDB_RemoveItems(t *testing.T) {
 		db *sql.DB
 	}
 	type args struct {
-		user model.User
-		ids  []int
+		ctx   context.Context
+		user  model.User
+		items []string
 	}
 	tests := []struct {
 		name    string
@@ -115,9 +119,50 @@ func TestRepositoryDB_RemoveItems(t *testing.T) {
 			repo := &RepositoryDB{
 				db: tt.fields.db,
 			}
-			if err := repo.RemoveItems(tt.args.user, tt.args.ids); (err != nil) != tt.wantErr {
+			if _, err := repo.RemoveItems(tt.args.ctx, tt.args.user, tt.args.items); (err != nil) != tt.wantErr {
 				t.Errorf("RemoveItems() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestUserLinksQuery(t *testing.T) {
+	at := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		query model.UserLinksQuery
+		where string
+		order string
+		args  []interface{}
+	}{
+		{
+			name:  "defaults",
+			where: "where user_id=$1 and not deleted order",
+			order: "order by created_at asc, id asc",
+			args:  []interface{}{model.User("u")},
+		},
+		{
+			name:  "page",
+			query: model.UserLinksQuery{Limit: 10, After: &model.Cursor{CreatedAt: at, Seq: 7}, Desc: true, Contains: "Ya.ru"},
+			where: "where user_id=$1 and not deleted and strpos(lower(origin_url), lower($2)) > 0 and (created_at, id) < ($3, $4) order",
+			order: "order by created_at desc, id desc limit $5",
+			args:  []interface{}{model.User("u"), "Ya.ru", at, 7, 10},
+		},
+		{
+			name:  "deleted",
+			query: model.UserLinksQuery{IncludeDeleted: true, After: &model.Cursor{CreatedAt: at, Seq: 7}},
+			where: "where user_id=$1 and (created_at, id) > ($2, $3) order",
+			order: "order by created_at asc, id asc",
+			args:  []interface{}{model.User("u"), at, 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := userLinksQuery("u", tt.query)
+			query = strings.Join(strings.Fields(query), " ")
+			assert.Contains(t, query, tt.where)
+			assert.True(t, strings.HasSuffix(query, tt.order), query)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
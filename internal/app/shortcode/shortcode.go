@@ -0,0 +1,138 @@
+// Генерация коротких кодов ссылок.
+package shortcode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"ilyakasharokov/internal/app/base62"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MaxLength максимальная длина кода, при которой 62^length помещается в uint64.
+const MaxLength = 10
+
+var ErrExhausted = errors.New("short code: collision attempts exhausted")
+
+// Generator выдает кандидата в короткий код для url. Номер попытки attempt
+// растет при каждой коллизии.
+type Generator interface {
+	Generate(url string, attempt int) string
+}
+
+// New создает генератор по имени: hash или sequence.
+func New(kind string, length int) (Generator, error) {
+	if length < 1 || length > MaxLength {
+		return nil, fmt.Errorf("short code: length must be between 1 and %d", MaxLength)
+	}
+	switch kind {
+	case "", "hash":
+		return NewHash(length), nil
+	case "sequence":
+		// счетчик начинается с текущего времени, чтобы после перезапуска не повторять выданные коды,
+		// поэтому код не может быть короче записи этого числа
+		start := uint64(time.Now().UnixMilli())
+		if size := len(base62.Encode(start)); length < size {
+			return nil, fmt.Errorf("short code: sequence length must be at least %d", size)
+		}
+		return NewSequence(start, length), nil
+	default:
+		return nil, fmt.Errorf("short code: unknown generator %q", kind)
+	}
+}
+
+// Hash детерминированный генератор: base62 от sha256(url, attempt).
+type Hash struct {
+	length int
+	modulo uint64
+}
+
+func NewHash(length int) *Hash {
+	return &Hash{
+		length: length,
+		modulo: modulo(length),
+	}
+}
+
+func (h *Hash) Generate(url string, attempt int) string {
+	sum := sha256.Sum256([]byte(url + "#" + strconv.Itoa(attempt)))
+	number := binary.BigEndian.Uint64(sum[:8]) % h.modulo
+	return base62.Pad(base62.Encode(number), h.length)
+}
+
+// Sequence генератор на основе возрастающего счетчика, url не учитывается.
+type Sequence struct {
+	next   uint64
+	length int
+}
+
+// NewSequence создает счетчик, начинающийся со start. Коды короче length дополняются слева.
+func NewSequence(start uint64, length int) *Sequence {
+	return &Sequence{
+		next:   start,
+		length: length,
+	}
+}
+
+func (s *Sequence) Generate(_ string, _ int) string {
+	number := atomic.AddUint64(&s.next, 1) - 1
+	return base62.Pad(base62.Encode(number), s.length)
+}
+
+// Allocator подбирает свободный код, повторяя генерацию при коллизиях не более attempts раз.
+type Allocator struct {
+	gen      Generator
+	attempts int
+}
+
+func NewAllocator(gen Generator, attempts int) *Allocator {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return &Allocator{
+		gen:      gen,
+		attempts: attempts,
+	}
+}
+
+// Allocate возвращает первый код, для которого taken вернул false. Когда заняты все кандидаты
+// генератора, например тот же URL уже сокращали другие пользователи, пробуются случайные коды той же длины.
+func (a *Allocator) Allocate(url string, taken func(code string) bool) (string, error) {
+	var code string
+	for attempt := 0; attempt < a.attempts; attempt++ {
+		code = a.gen.Generate(url, attempt)
+		if !taken(code) {
+			return code, nil
+		}
+	}
+	for attempt := 0; attempt < a.attempts; attempt++ {
+		code = random(len(code))
+		if !taken(code) {
+			return code, nil
+		}
+	}
+	return "", ErrExhausted
+}
+
+// random случайный код длины length, но не длиннее MaxLength.
+func random(length int) string {
+	if length > MaxLength {
+		length = MaxLength
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return base62.Pad(base62.Encode(binary.BigEndian.Uint64(b[:])%modulo(length)), length)
+}
+
+// modulo число кодов длины length.
+func modulo(length int) uint64 {
+	m := uint64(1)
+	for i := 0; i < length; i++ {
+		m *= 62
+	}
+	return m
+}
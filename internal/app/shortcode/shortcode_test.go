@@ -0,0 +1,84 @@
+package shortcode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testURL = "https://yandex.ru"
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		length  int
+		wantErr bool
+	}{
+		{name: "hash", kind: "hash", length: 8},
+		{name: "default", kind: "", length: 8},
+		{name: "sequence", kind: "sequence", length: 7},
+		{name: "sequence too short", kind: "sequence", length: 6, wantErr: true},
+		{name: "unknown", kind: "random", length: 8, wantErr: true},
+		{name: "too long", kind: "hash", length: MaxLength + 1, wantErr: true},
+		{name: "zero length", kind: "hash", length: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := New(tt.kind, tt.length)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.GreaterOrEqual(t, len(gen.Generate(testURL, 0)), tt.length)
+		})
+	}
+}
+
+func TestHash_Generate(t *testing.T) {
+	h := NewHash(8)
+	code := h.Generate(testURL, 0)
+	assert.Len(t, code, 8)
+	assert.Equal(t, code, h.Generate(testURL, 0))
+	assert.NotEqual(t, code, h.Generate(testURL, 1))
+	assert.NotEqual(t, code, h.Generate(testURL+"/other", 0))
+}
+
+func TestSequence_Generate(t *testing.T) {
+	s := NewSequence(0, 3)
+	assert.Equal(t, "aaa", s.Generate(testURL, 0))
+	assert.Equal(t, "aab", s.Generate(testURL, 0))
+}
+
+func TestAllocator_Allocate(t *testing.T) {
+	h := NewHash(8)
+	taken := map[string]bool{h.Generate(testURL, 0): true}
+
+	code, err := NewAllocator(h, 3).Allocate(testURL, func(code string) bool { return taken[code] })
+	assert.NoError(t, err)
+	assert.Equal(t, h.Generate(testURL, 1), code)
+
+	_, err = NewAllocator(h, 3).Allocate(testURL, func(string) bool { return true })
+	assert.ErrorIs(t, err, ErrExhausted)
+}
+
+func TestAllocator_AllocateFallback(t *testing.T) {
+	h := NewHash(8)
+	taken := map[string]bool{}
+	for attempt := 0; attempt < 3; attempt++ {
+		taken[h.Generate(testURL, attempt)] = true
+	}
+	// все кандидаты хеша заняты тем же URL других пользователей
+	code, err := NewAllocator(h, 3).Allocate(testURL, func(code string) bool { return taken[code] })
+	assert.NoError(t, err)
+	assert.Len(t, code, 8)
+	assert.False(t, taken[code])
+}
+
+func BenchmarkHash_Generate(b *testing.B) {
+	h := NewHash(8)
+	for i := 0; i < b.N; i++ {
+		h.Generate(testURL, i)
+	}
+}
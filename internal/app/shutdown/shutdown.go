@@ -0,0 +1,64 @@
+// Поэтапная остановка сервиса.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrTimeout возвращается Run, если хотя бы один этап не уложился в срок.
+var ErrTimeout = errors.New("shutdown timed out")
+
+// Phase этап остановки. Run получает контекст со сроком Timeout.
+type Phase struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Run выполняет этапы по порядку и пишет в лог результат каждого.
+// Этап, не завершившийся в срок, не ждут и переходят к следующему.
+// Ошибки этапов только логируются, результат отражает лишь превышение сроков.
+func Run(phases ...Phase) error {
+	var timedOut []string
+	for _, p := range phases {
+		start := time.Now()
+		log.Info().Str("phase", p.Name).Msg("Shutdown phase started")
+		err := run(p)
+		elapsed := time.Since(start)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			timedOut = append(timedOut, p.Name)
+			log.Error().Str("phase", p.Name).Dur("elapsed", elapsed).Msg("Shutdown phase timed out")
+		case err != nil:
+			log.Err(err).Str("phase", p.Name).Dur("elapsed", elapsed).Msg("Shutdown phase failed")
+		default:
+			log.Info().Str("phase", p.Name).Dur("elapsed", elapsed).Msg("Shutdown phase done")
+		}
+	}
+	if len(timedOut) > 0 {
+		return fmt.Errorf("%w: %s", ErrTimeout, strings.Join(timedOut, ", "))
+	}
+	return nil
+}
+
+// run выполняет этап в отдельной горутине, чтобы не зависеть от того, учитывает ли он ctx.
+func run(p Phase) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
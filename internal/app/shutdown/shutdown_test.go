@@ -0,0 +1,52 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var order []string
+	step := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, name)
+			return err
+		}
+	}
+	err := Run(
+		Phase{Name: "http", Timeout: time.Second, Run: step("http", nil)},
+		Phase{Name: "workers", Timeout: time.Second, Run: step("workers", errors.New("boom"))},
+		Phase{Name: "storage", Timeout: time.Second, Run: step("storage", nil)},
+	)
+	// ошибка этапа не прерывает остановку и не считается превышением срока
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http", "workers", "storage"}, order)
+}
+
+func TestRun_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	var storage bool
+	err := Run(
+		Phase{Name: "workers", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		// этап, не учитывающий ctx, тоже ограничен сроком
+		Phase{Name: "flush", Timeout: 10 * time.Millisecond, Run: func(context.Context) error {
+			<-block
+			return nil
+		}},
+		Phase{Name: "storage", Timeout: time.Second, Run: func(context.Context) error {
+			storage = true
+			return nil
+		}},
+	)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Contains(t, err.Error(), "workers, flush")
+	assert.True(t, storage)
+}
@@ -0,0 +1,78 @@
+// Фабрика хранилищ: выбирает postgres или хранение в памяти/фаиле по конфигурации.
+package storage
+
+import (
+	"database/sql"
+	"ilyakasharokov/cmd/shortener/configuration"
+	"ilyakasharokov/internal/app/analytics"
+	"ilyakasharokov/internal/app/deletion"
+	"ilyakasharokov/internal/app/handlers"
+	"ilyakasharokov/internal/app/repository"
+	"ilyakasharokov/internal/app/repositorydb"
+	"ilyakasharokov/internal/app/shortcode"
+	"sync"
+
+	_ "github.com/lib/pq"
+)
+
+// ClickStore хранилище переходов по ссылкам.
+type ClickStore interface {
+	analytics.Store
+	handlers.ClickStatsModel
+}
+
+// Storage выбранное при старте хранилище.
+type Storage struct {
+	// Repo репозиторий ссылок.
+	Repo handlers.RepoDBModel
+	// Clicks хранилище переходов.
+	Clicks ClickStore
+	// Jobs хранилище задач удаления.
+	Jobs deletion.Store
+	// DB подключение к базе, nil при хранении в памяти.
+	DB        *sql.DB
+	close     func() error
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New создает хранилище. Если DATABASE_DSN не задан, используется хранение в памяти
+// со снимком и журналом в FILE_STORAGE_PATH. Коды для пакетного сохранения подбирает codes.
+func New(cfg configuration.Config, codes *shortcode.Allocator) (*Storage, error) {
+	if cfg.Database == "" {
+		repo, err := repository.Open(cfg.FileStoragePath, codes, repository.Options{
+			Sync:         repository.SyncPolicy(cfg.FileSync),
+			SyncInterval: cfg.FileSyncInterval,
+			CompactEvery: cfg.FileCompactEvery,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Storage{
+			Repo:   repo,
+			Clicks: repo,
+			Jobs:   repo,
+			close:  repo.Close,
+		}, nil
+	}
+	db, err := sql.Open("postgres", cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	repo := repositorydb.New(db, codes)
+	return &Storage{
+		Repo:   repo,
+		Clicks: repo,
+		Jobs:   repo,
+		DB:     db,
+		close:  db.Close,
+	}, nil
+}
+
+// Close сохраняет данные и освобождает ресурсы хранилища. Повторные вызовы возвращают результат первого.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+	return s.closeErr
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"ilyakasharokov/cmd/shortener/configuration"
+	"ilyakasharokov/internal/app/repository"
+	"ilyakasharokov/internal/app/repositorydb"
+	"ilyakasharokov/internal/app/shortcode"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    configuration.Config
+		wantDB bool
+	}{
+		{
+			name:   "memory without dsn",
+			cfg:    configuration.Config{},
+			wantDB: false,
+		},
+		{
+			name:   "postgres with dsn",
+			cfg:    configuration.Config{Database: "postgres://localhost/shortener?sslmode=disable"},
+			wantDB: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.cfg, shortcode.NewAllocator(shortcode.NewHash(8), 3))
+			assert.NoError(t, err)
+			if tt.wantDB {
+				assert.IsType(t, &repositorydb.RepositoryDB{}, s.Repo)
+				assert.NotNil(t, s.DB)
+			} else {
+				assert.IsType(t, &repository.Repository{}, s.Repo)
+				assert.Nil(t, s.DB)
+			}
+			assert.NoError(t, s.Close())
+		})
+	}
+}
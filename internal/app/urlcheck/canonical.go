@@ -0,0 +1,88 @@
+package urlcheck
+
+import (
+	urltool "net/url"
+	"sort"
+	"strings"
+)
+
+// TrackingParams известные параметры отслеживания переходов.
+var TrackingParams = []string{"utm_*", "fbclid", "gclid", "yclid", "_openstat"}
+
+// Rules правила приведения URL к каноническому виду, чтобы один адрес не сокращался дважды.
+// Схема и домен всегда приводятся к нижнему регистру, порт по умолчанию и пустой путь убираются.
+type Rules struct {
+	// SortQuery сортирует параметры запроса по имени, порядок одноименных параметров сохраняется.
+	SortQuery bool
+	// StripParams удаляемые параметры запроса, шаблон с * на конце задает префикс, например utm_*.
+	StripParams []string
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// canonicalize приводит u к каноническому виду по правилам.
+func (r Rules) canonicalize(u *urltool.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+	u.ForceQuery = false
+	if u.RawQuery != "" {
+		u.RawQuery = r.query(u.RawQuery)
+	}
+}
+
+// query обрабатывает строку запроса, не меняя экранирование оставшихся параметров.
+func (r Rules) query(raw string) string {
+	type param struct {
+		name string
+		raw  string
+	}
+	var params []param
+	for _, segment := range strings.Split(raw, "&") {
+		if segment == "" {
+			continue
+		}
+		name := segment
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name = name[:i]
+		}
+		if unescaped, err := urltool.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if r.strip(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: segment})
+	}
+	if r.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+	segments := make([]string, len(params))
+	for i, p := range params {
+		segments[i] = p.raw
+	}
+	return strings.Join(segments, "&")
+}
+
+func (r Rules) strip(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range r.StripParams {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
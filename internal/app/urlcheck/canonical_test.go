@@ -0,0 +1,65 @@
+package urlcheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Canonical(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules Rules
+		url   string
+		want  string
+	}{
+		{name: "case and default port", url: "HTTP://Example.COM:80/Path", want: "http://example.com/Path"},
+		{name: "https default port", url: "https://example.com:443", want: "https://example.com/"},
+		{name: "other port kept", url: "https://example.com:8443/", want: "https://example.com:8443/"},
+		{name: "ipv6", url: "http://[2001:DB8::1]:80/", want: "http://[2001:db8::1]/"},
+		{name: "ipv6 port", url: "http://[2001:DB8::1]:8080/", want: "http://[2001:db8::1]:8080/"},
+		{name: "empty query", url: "http://example.com/a?", want: "http://example.com/a"},
+		{name: "query kept", url: "http://example.com/a?b=1&a=2", want: "http://example.com/a?b=1&a=2"},
+		{
+			name:  "sorted query",
+			rules: Rules{SortQuery: true},
+			url:   "HTTP://Example.com:80/a?b=1&a=2",
+			want:  "http://example.com/a?a=2&b=1",
+		},
+		{
+			name:  "same names keep order",
+			rules: Rules{SortQuery: true},
+			url:   "http://example.com/?z=1&a=2&z=0&&a=1",
+			want:  "http://example.com/?a=2&a=1&z=1&z=0",
+		},
+		{
+			name:  "escaping kept",
+			rules: Rules{SortQuery: true},
+			url:   "http://example.com/?q=a+b%26c&flag&%61=1",
+			want:  "http://example.com/?%61=1&flag&q=a+b%26c",
+		},
+		{
+			name:  "tracking stripped",
+			rules: Rules{SortQuery: true, StripParams: TrackingParams},
+			url:   "https://example.com/a?utm_source=x&b=1&UTM_Medium=y&fbclid=z&a=2#top",
+			want:  "https://example.com/a?a=2&b=1#top",
+		},
+		{
+			name:  "only tracking",
+			rules: Rules{StripParams: []string{"utm_*"}},
+			url:   "https://example.com/a?utm_source=x",
+			want:  "https://example.com/a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New("", Options{Schemes: []string{"http", "https"}, Canonical: tt.rules})
+			require.NoError(t, err)
+			got, err := c.Check(context.Background(), tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Проверка безопасности URL перед сокращением.
+package urlcheck
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	urltool "net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Коды причин отказа.
+const (
+	ReasonInvalid      = "invalid_url"
+	ReasonTooLong      = "url_too_long"
+	ReasonScheme       = "scheme_not_allowed"
+	ReasonInvalidHost  = "invalid_host"
+	ReasonBlocked      = "blocked_host"
+	ReasonPrivate      = "private_address"
+	ReasonSelf         = "self_reference"
+	ReasonUnresolvable = "unresolvable_host"
+)
+
+// Error отказ в сокращении URL с машиночитаемой причиной.
+type Error struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func reject(reason string, format string, args ...interface{}) *Error {
+	return &Error{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// Options настройки проверки.
+type Options struct {
+	// Schemes допустимые схемы в нижнем регистре.
+	Schemes []string
+	// MaxLength максимальная длина URL в байтах, 0 без ограничения.
+	MaxLength int
+	// BlocklistFile фаил с запрещенными доменами, адресами и подсетями по одному на строку.
+	// Домен запрещает и все свои поддомены, строки с # комментарии.
+	BlocklistFile string
+	// Resolve проверяет адреса, в которые разрешается домен. Без него проверяются только IP в URL.
+	Resolve bool
+	// Canonical правила приведения URL к каноническому виду.
+	Canonical Rules
+}
+
+// DefaultOptions настройки по умолчанию.
+var DefaultOptions = Options{
+	Schemes:   []string{"http", "https"},
+	MaxLength: 2048,
+	Canonical: Rules{SortQuery: true},
+}
+
+// Resolver разрешает доменные имена, реализуется net.Resolver.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Checker проверяет и нормализует URL.
+type Checker struct {
+	schemes   map[string]bool
+	maxLength int
+	domains   map[string]bool
+	nets      []*net.IPNet
+	self      string
+	resolver  Resolver
+	rules     Rules
+}
+
+// hostProfile правила IDNA для поиска доменов, но с подчеркиванием, которое встречается в реальных именах хостов.
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// reservedNets диапазоны, не покрытые методами net.IP: CGNAT, "этот" сеть и тестовые сети.
+var reservedNets = mustCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4")
+
+// New создает проверку. baseURL адрес самого сервиса, ссылки на него запрещены, чтобы не было петель редиректов.
+func New(baseURL string, opts Options) (*Checker, error) {
+	c := &Checker{
+		schemes:   make(map[string]bool),
+		maxLength: opts.MaxLength,
+		domains:   make(map[string]bool),
+		rules:     Rules{SortQuery: opts.Canonical.SortQuery},
+	}
+	for _, param := range opts.Canonical.StripParams {
+		if param = strings.ToLower(strings.TrimSpace(param)); param != "" {
+			c.rules.StripParams = append(c.rules.StripParams, param)
+		}
+	}
+	for _, scheme := range opts.Schemes {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			c.schemes[scheme] = true
+		}
+	}
+	if len(c.schemes) == 0 {
+		return nil, fmt.Errorf("no url schemes allowed")
+	}
+	if baseURL != "" {
+		u, err := urltool.Parse(baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("base url: %w", err)
+		}
+		if c.self, err = asciiHost(u.Hostname()); err != nil {
+			return nil, fmt.Errorf("base url: %w", err)
+		}
+	}
+	if opts.BlocklistFile != "" {
+		if err := c.loadBlocklist(opts.BlocklistFile); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Resolve {
+		c.resolver = net.DefaultResolver
+	}
+	return c, nil
+}
+
+// Block добавляет в список запрещенных домен, адрес или подсеть.
+func (c *Checker) Block(entry string) error {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if strings.Contains(entry, "/") {
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return err
+		}
+		c.nets = append(c.nets, ipnet)
+		return nil
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		c.nets = append(c.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return nil
+	}
+	domain, err := asciiHost(strings.TrimPrefix(entry, "*."))
+	if err != nil {
+		return err
+	}
+	c.domains[domain] = true
+	return nil
+}
+
+func (c *Checker) loadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := c.Block(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Check проверяет URL и возвращает его канонический вид с доменом в punycode.
+// Отказ возвращается как *Error.
+func (c *Checker) Check(ctx context.Context, raw string) (string, error) {
+	if c.maxLength > 0 && len(raw) > c.maxLength {
+		return "", reject(ReasonTooLong, "the url is longer than %d bytes", c.maxLength)
+	}
+	u, err := urltool.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return "", reject(ReasonInvalid, "the url is incorrect")
+	}
+	if !c.schemes[strings.ToLower(u.Scheme)] {
+		return "", reject(ReasonScheme, "the url scheme %q is not allowed", u.Scheme)
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", reject(ReasonInvalid, "the url has no host")
+	}
+	host, err := asciiHost(u.Hostname())
+	if err != nil {
+		return "", reject(ReasonInvalidHost, "the url host is incorrect")
+	}
+	if host != u.Hostname() {
+		port := u.Port()
+		u.Host = host
+		if port != "" {
+			u.Host = net.JoinHostPort(host, port)
+		}
+	}
+	if c.self != "" && host == c.self {
+		return "", reject(ReasonSelf, "the url points to this service")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := c.checkIP(ip); err != nil {
+			return "", err
+		}
+	} else if err := c.checkHost(ctx, host); err != nil {
+		return "", err
+	}
+	c.rules.canonicalize(u)
+	return u.String(), nil
+}
+
+// checkHost проверяет домен и, если включено, адреса, в которые он разрешается.
+func (c *Checker) checkHost(ctx context.Context, host string) error {
+	if err := c.checkDomain(host); err != nil {
+		return err
+	}
+	if c.resolver == nil {
+		return nil
+	}
+	addrs, err := c.resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return reject(ReasonUnresolvable, "the url host can't be resolved")
+	}
+	for _, addr := range addrs {
+		if err := c.checkIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkIP(ip net.IP) *Error {
+	if isPrivate(ip) {
+		return reject(ReasonPrivate, "the url points to a private address")
+	}
+	for _, ipnet := range c.nets {
+		if ipnet.Contains(ip) {
+			return reject(ReasonBlocked, "the url host is blocked")
+		}
+	}
+	return nil
+}
+
+func (c *Checker) checkDomain(host string) *Error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return reject(ReasonPrivate, "the url points to a private address")
+	}
+	// браузеры понимают адреса вроде 2130706433 или 0x7f.1, а настоящий домен верхнего уровня не бывает числом
+	labels := strings.Split(host, ".")
+	for _, label := range labels {
+		if label == "" {
+			return reject(ReasonInvalidHost, "the url host is incorrect")
+		}
+	}
+	if tld := labels[len(labels)-1]; strings.Trim(tld, "0123456789abcdefx") == "" && strings.IndexAny(tld, "0123456789") == 0 {
+		return reject(ReasonInvalidHost, "the url host is incorrect")
+	}
+	for i := range labels {
+		if c.domains[strings.Join(labels[i:], ".")] {
+			return reject(ReasonBlocked, "the url host is blocked")
+		}
+	}
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, ipnet := range reservedNets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// asciiHost переводит домен в punycode в нижнем регистре, IP возвращает как есть.
+func asciiHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	return hostProfile.ToASCII(host)
+}
+
+func mustCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets
+}
@@ -0,0 +1,124 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testResolver разрешает домены по таблице.
+type testResolver map[string]string
+
+func (r testResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ip, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+}
+
+func TestChecker_Check(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist")
+	require.NoError(t, os.WriteFile(blocklist, []byte("# фишинг\nevil.com\n*.bad.org # с поддоменами\n203.0.113.0/24\n198.51.100.7\n\n"), 0600))
+	c, err := New("https://short.example/", Options{
+		Schemes:       []string{"http", "HTTPS"},
+		MaxLength:     64,
+		BlocklistFile: blocklist,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		url    string
+		want   string
+		reason string
+	}{
+		{name: "ok", url: "https://ya.ru/path?q=1", want: "https://ya.ru/path?q=1"},
+		{name: "upper scheme", url: "HTTP://ya.ru", want: "http://ya.ru/"},
+		{name: "idn", url: "http://пример.рф/путь", want: "http://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "idn with port", url: "http://Пример.рф:8080/", want: "http://xn--e1afmkfd.xn--p1ai:8080/"},
+		{name: "public ip", url: "http://8.8.8.8/", want: "http://8.8.8.8/"},
+		{name: "too long", url: "https://ya.ru/" + strings.Repeat("a", 64), reason: ReasonTooLong},
+		{name: "not url", url: "asdfasfsa", reason: ReasonInvalid},
+		{name: "no host", url: "http:///path", reason: ReasonInvalid},
+		{name: "javascript", url: "javascript:alert(1)", reason: ReasonScheme},
+		{name: "data", url: "data:text/html;base64,PHNjcmlwdD4=", reason: ReasonScheme},
+		{name: "file", url: "file:///etc/passwd", reason: ReasonScheme},
+		{name: "ftp", url: "ftp://ya.ru/file", reason: ReasonScheme},
+		{name: "localhost", url: "http://localhost:8080/", reason: ReasonPrivate},
+		{name: "localhost subdomain", url: "http://app.localhost/", reason: ReasonPrivate},
+		{name: "loopback", url: "http://127.0.0.2/", reason: ReasonPrivate},
+		{name: "private", url: "http://192.168.1.1/", reason: ReasonPrivate},
+		{name: "link local", url: "http://169.254.169.254/latest/meta-data", reason: ReasonPrivate},
+		{name: "cgnat", url: "http://100.64.0.1/", reason: ReasonPrivate},
+		{name: "ipv6 loopback", url: "http://[::1]/", reason: ReasonPrivate},
+		{name: "ipv4 mapped", url: "http://[::ffff:10.0.0.1]/", reason: ReasonPrivate},
+		{name: "unspecified", url: "http://0.0.0.0/", reason: ReasonPrivate},
+		{name: "decimal ip", url: "http://2130706433/", reason: ReasonInvalidHost},
+		{name: "hex ip", url: "http://0x7f.1/", reason: ReasonInvalidHost},
+		{name: "underscore", url: "http://my_host.example.com/", want: "http://my_host.example.com/"},
+		{name: "bad idn", url: "http://xn--a.com/", reason: ReasonInvalidHost},
+		{name: "empty label", url: "http://a..b/", reason: ReasonInvalidHost},
+		{name: "blocked domain", url: "https://evil.com/login", reason: ReasonBlocked},
+		{name: "blocked subdomain", url: "https://www.EVIL.com./login", reason: ReasonBlocked},
+		{name: "blocked wildcard", url: "https://x.bad.org/", reason: ReasonBlocked},
+		{name: "similar domain", url: "https://notevil.com/", want: "https://notevil.com/"},
+		{name: "blocked net", url: "http://203.0.113.9/", reason: ReasonBlocked},
+		{name: "blocked ip", url: "http://198.51.100.7/", reason: ReasonBlocked},
+		{name: "self", url: "https://short.example/abc", reason: ReasonSelf},
+		{name: "self other port", url: "http://SHORT.example:8080/abc", reason: ReasonSelf},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Check(context.Background(), tt.url)
+			if tt.reason == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+				return
+			}
+			var rejected *Error
+			require.ErrorAs(t, err, &rejected)
+			assert.Equal(t, tt.reason, rejected.Reason)
+		})
+	}
+}
+
+func TestChecker_Resolve(t *testing.T) {
+	c, err := New("", DefaultOptions)
+	require.NoError(t, err)
+	c.resolver = testResolver{"public.example": "93.184.216.34", "internal.example": "10.1.2.3"}
+
+	_, err = c.Check(context.Background(), "https://public.example/")
+	assert.NoError(t, err)
+	tests := map[string]string{
+		"https://internal.example/": ReasonPrivate,
+		"https://missing.example/":  ReasonUnresolvable,
+	}
+	for url, reason := range tests {
+		_, err = c.Check(context.Background(), url)
+		var rejected *Error
+		require.ErrorAs(t, err, &rejected)
+		assert.Equal(t, reason, rejected.Reason)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("", Options{Schemes: []string{" "}})
+	assert.Error(t, err)
+
+	_, err = New("", Options{Schemes: []string{"http"}, BlocklistFile: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+
+	blocklist := filepath.Join(t.TempDir(), "blocklist")
+	require.NoError(t, os.WriteFile(blocklist, []byte("ok.com\n10.0.0.0/99\n"), 0600))
+	_, err = New("", Options{Schemes: []string{"http"}, BlocklistFile: blocklist})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "blocklist:2")
+}
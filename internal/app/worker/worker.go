@@ -3,49 +3,157 @@ package worker
 
 import (
 	"context"
-	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 type WorkerPool struct {
 	numOfWorkers int
 	inputCh      chan func(ctx context.Context) error
+	quit         chan struct{}
+	quitOnce     sync.Once
+	done         chan struct{}
+	busy         int64
+	completed    int64
+	failed       int64
+}
+
+// Stats состояние пула для мониторинга.
+type Stats struct {
+	Workers int
+	// Queued задачи в очереди, Busy воркеры, выполняющие задачу.
+	Queued int
+	Busy   int64
+	// Completed и Failed число выполненных задач, Failed из них завершились ошибкой.
+	Completed int64
+	Failed    int64
 }
 
 func New(numOfWorkers int, buffer int) *WorkerPool {
 	wp := &WorkerPool{
 		numOfWorkers: numOfWorkers,
 		inputCh:      make(chan func(ctx context.Context) error, buffer),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
 	}
 	return wp
 }
 
+// Run выполняет задачи до отмены ctx или до Shutdown. Отмена ctx останавливает воркеры сразу,
+// после Shutdown воркеры сначала выполняют оставшиеся в очереди задачи.
 func (wp *WorkerPool) Run(ctx context.Context) {
 	wg := &sync.WaitGroup{}
 	for i := 0; i < wp.numOfWorkers; i++ {
 		wg.Add(1)
 		go func(i int) {
-			fmt.Printf("Worker #%v start \n", i)
-		outer:
+			defer wg.Done()
+			log.Debug().Int("worker", i).Msg("Worker start")
 			for {
 				select {
 				case f := <-wp.inputCh:
-					err := f(ctx)
-					if err != nil {
-						fmt.Printf("Error on worker #%v: %v\n", i, err.Error())
+					if ctx.Err() != nil {
+						return
 					}
+					wp.exec(ctx, i, f)
 				case <-ctx.Done():
-					break outer
+					return
+				case <-wp.quit:
+					wp.drain(ctx, i)
+					return
 				}
-
 			}
-			wg.Done()
 		}(i)
 	}
 	wg.Wait()
-	close(wp.inputCh)
+	close(wp.done)
+}
+
+func (wp *WorkerPool) drain(ctx context.Context, i int) {
+	for ctx.Err() == nil {
+		select {
+		case f := <-wp.inputCh:
+			wp.exec(ctx, i, f)
+		default:
+			return
+		}
+	}
+}
+
+func (wp *WorkerPool) exec(ctx context.Context, i int, f func(ctx context.Context) error) {
+	atomic.AddInt64(&wp.busy, 1)
+	err := f(ctx)
+	atomic.AddInt64(&wp.busy, -1)
+	atomic.AddInt64(&wp.completed, 1)
+	if err != nil {
+		atomic.AddInt64(&wp.failed, 1)
+		log.Err(err).Int("worker", i).Msg("Task failed")
+	}
+}
+
+// Stats возвращает текущее состояние пула.
+func (wp *WorkerPool) Stats() Stats {
+	return Stats{
+		Workers:   wp.numOfWorkers,
+		Queued:    len(wp.inputCh),
+		Busy:      atomic.LoadInt64(&wp.busy),
+		Completed: atomic.LoadInt64(&wp.completed),
+		Failed:    atomic.LoadInt64(&wp.failed),
+	}
+}
+
+// Shutdown просит воркеры выполнить оставшиеся задачи и завершиться и ждет их не дольше, чем живет ctx.
+// Прервать выполняющиеся задачи можно отменой контекста Run.
+func (wp *WorkerPool) Shutdown(ctx context.Context) error {
+	wp.quitOnce.Do(func() {
+		close(wp.quit)
+	})
+	select {
+	case <-wp.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (wp *WorkerPool) Push(task func(ctx context.Context) error) {
 	wp.inputCh <- task
 }
+
+// TryPush ставит задачу в очередь, только если в ней есть место.
+func (wp *WorkerPool) TryPush(task func(ctx context.Context) error) bool {
+	select {
+	case wp.inputCh <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// PushContext ставит задачу в очередь, ожидая свободного места не дольше, чем живет ctx.
+func (wp *WorkerPool) PushContext(ctx context.Context, task func(ctx context.Context) error) error {
+	select {
+	case wp.inputCh <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Every ставит задачу в очередь каждые interval, пока не отменен ctx.
+func (wp *WorkerPool) Every(ctx context.Context, interval time.Duration, task func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if wp.PushContext(ctx, task) != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPool_Every(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wp := New(1, 1)
+	go wp.Run(ctx)
+
+	var calls int32
+	go wp.Every(ctx, 10*time.Millisecond, func(_ context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) >= 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestWorkerPool_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wp := New(1, 10)
+	release := make(chan struct{})
+	var calls int32
+	task := func(_ context.Context) error {
+		<-release
+		atomic.AddInt32(&calls, 1)
+		return nil
+	}
+	for i := 0; i < 5; i++ {
+		assert.True(t, wp.TryPush(task))
+	}
+	go wp.Run(ctx)
+
+	// задачи еще выполняются, срок вышел
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	assert.ErrorIs(t, wp.Shutdown(short), context.DeadlineExceeded)
+
+	// очередь выполняется до конца
+	close(release)
+	assert.NoError(t, wp.Shutdown(context.Background()))
+	assert.EqualValues(t, 5, atomic.LoadInt32(&calls))
+}
+
+func TestWorkerPool_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wp := New(1, 10)
+	started := make(chan struct{})
+	assert.True(t, wp.TryPush(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	assert.True(t, wp.TryPush(func(_ context.Context) error {
+		t.Error("queued task must not run after cancel")
+		return nil
+	}))
+	go wp.Run(ctx)
+	<-started
+	cancel()
+	assert.NoError(t, wp.Shutdown(context.Background()))
+}
+
+func TestWorkerPool_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wp := New(2, 10)
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		assert.True(t, wp.TryPush(func(_ context.Context) error {
+			started <- struct{}{}
+			<-release
+			return errors.New("boom")
+		}))
+	}
+	assert.True(t, wp.TryPush(func(_ context.Context) error { return nil }))
+	assert.Equal(t, Stats{Workers: 2, Queued: 3}, wp.Stats())
+
+	go wp.Run(ctx)
+	<-started
+	<-started
+	assert.Equal(t, Stats{Workers: 2, Queued: 1, Busy: 2}, wp.Stats())
+
+	close(release)
+	assert.NoError(t, wp.Shutdown(context.Background()))
+	assert.Equal(t, Stats{Workers: 2, Completed: 3, Failed: 2}, wp.Stats())
+}
@@ -0,0 +1,4 @@
+// Клиент и сервер gRPC API сокращателя, сгенерированы из api/proto/shortener.proto.
+package pb
+
+//go:generate sh -c "cd ../../api/proto && buf generate --template buf.gen.yaml -o ../.. ."